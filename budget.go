@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Sources whose lookups are requests to someone else's server, and count
+// towards the daily budget
+var meteredSources = map[string]bool{
+	"cardshark": true,
+}
+
+// How many of the deferred entries are listed at the end of a run
+const maxReportedDeferred = 10
+
+// Returned by the lookups made once the budget for the day is used up
+var errBudgetExhausted = errors.New("daily request budget exhausted")
+
+// Default file keeping the count of the requests made today
+const QuotaFile = "quota.json"
+
+// The number of requests allowed each day, zero means no limit; the count
+// is kept in a file, so that it survives restarts and is shared by the
+// commands run in the same directory, under a lock file as the count is
+// replaced rather than rewritten
+type requestBudget struct {
+	mu    sync.Mutex
+	path  string
+	limit int
+
+	// the count as of the last time the file was read
+	last   quota
+	loaded bool
+}
+
+type quota struct {
+	Day  string `json:"day"`
+	Used int    `json:"used"`
+}
+
+func newRequestBudget(path string, limit int) *requestBudget {
+	return &requestBudget{path: path, limit: limit}
+}
+
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// Hold the lock file shared with the other processes, the returned
+// function releases it
+func (b *requestBudget) lock() (func(), error) {
+	file, err := os.OpenFile(b.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = lockFile(file, true)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
+
+// Read the count of today, must be called with both locks held
+func (b *requestBudget) load() (quota, error) {
+	q := quota{Day: today()}
+	data, err := ioutil.ReadFile(b.path)
+	if err != nil && !os.IsNotExist(err) {
+		return q, err
+	}
+	if err == nil {
+		var stored quota
+		err = json.Unmarshal(data, &stored)
+		if err != nil {
+			return q, fmt.Errorf("Error loading %s: %s", b.path, err.Error())
+		}
+		if stored.Day == q.Day {
+			q = stored
+		}
+	}
+	b.last, b.loaded = q, true
+	return q, nil
+}
+
+// Replace the count at once, so that it is never seen half written
+func (b *requestBudget) save(q quota) error {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(b.path), filepath.Base(b.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), b.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	b.last = q
+	return nil
+}
+
+// Use one request, errBudgetExhausted if none is left for today
+func (b *requestBudget) take() error {
+	return b.add(1)
+}
+
+// Count n more requests, or give them back if negative; more requests
+// than are left for today are errBudgetExhausted
+func (b *requestBudget) add(n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	unlock, err := b.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	q, err := b.load()
+	if err != nil {
+		return err
+	}
+	if n > 0 && b.limit > 0 && q.Used+n > b.limit {
+		return errBudgetExhausted
+	}
+	q.Used += n
+	if q.Used < 0 {
+		q.Used = 0
+	}
+	return b.save(q)
+}
+
+// The requests of an entry, taken before it is handed to a worker so
+// that the entries get the budget in the order they are dispatched, and
+// not in the order the workers happen to get to their lookups
+type reservation struct {
+	mu     sync.Mutex
+	budget *requestBudget
+	left   int
+}
+
+type reservationKey struct{}
+
+// Take n requests at once for the lookups made with the returned context
+func (b *requestBudget) reserve(ctx context.Context, n int) (context.Context, *reservation, error) {
+	err := b.add(n)
+	if err != nil {
+		return ctx, nil, err
+	}
+	r := &reservation{budget: b, left: n}
+	return context.WithValue(ctx, reservationKey{}, r), r, nil
+}
+
+// The context of lookups that get no request, as none is left: the
+// metered sources are skipped, without taking one from the lookups of the
+// entries that come before
+func (b *requestBudget) withoutRequests(ctx context.Context) context.Context {
+	return context.WithValue(ctx, reservationKey{}, &reservation{budget: b})
+}
+
+// Use one of the requests reserved, false if there is none left
+func (r *reservation) use() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.left == 0 {
+		return false
+	}
+	r.left--
+	return true
+}
+
+// Give back the requests that were not used, as when the entry was
+// skipped or found in the cache
+func (r *reservation) release() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.left
+	r.left = 0
+	if n == 0 {
+		return nil
+	}
+	return r.budget.add(-n)
+}
+
+// The requests made today, as of the last request of this process; the
+// ones made since by others are only counted by the following take
+func (b *requestBudget) used() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.loaded || b.last.Day != today() {
+		unlock, err := b.lock()
+		if err != nil {
+			return b.last.Used
+		}
+		defer unlock()
+		b.load()
+	}
+	if b.last.Day != today() {
+		return 0
+	}
+	return b.last.Used
+}
+
+// The requests left for today, -1 if there is no limit
+func (b *requestBudget) left() int {
+	if b.limit <= 0 {
+		return -1
+	}
+	left := b.limit - b.used()
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// A source counting its lookups against the budget
+type budgetedSource struct {
+	PriceSource
+	budget *requestBudget
+}
+
+func (bs *budgetedSource) Lookup(ctx context.Context, c card) ([]offer, error) {
+	// the lookups of the entries dispatched in a run use the requests
+	// reserved for them, the other ones take their own
+	r, _ := ctx.Value(reservationKey{}).(*reservation)
+	if r != nil && r.budget == bs.budget {
+		if !r.use() {
+			return nil, errBudgetExhausted
+		}
+	} else {
+		err := bs.budget.take()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bs.PriceSource.Lookup(ctx, c)
+}
+
+func (bs *budgetedSource) SupportsLanguage(lang string) bool {
+	ls, ok := bs.PriceSource.(LanguageSource)
+	return ok && ls.SupportsLanguage(lang)
+}
+
+// Wrap the metered sources so that they respect the budget
+func budgetSources(sources []PriceSource, budget *requestBudget) []PriceSource {
+	wrapped := make([]PriceSource, len(sources))
+	for i, src := range sources {
+		wrapped[i] = src
+		if meteredSources[src.Name()] {
+			wrapped[i] = &budgetedSource{src, budget}
+		}
+	}
+	return wrapped
+}
+
+// The budget the sources count their requests against, nil if none does
+func sourcesBudget(sources []PriceSource) *requestBudget {
+	for _, src := range sources {
+		switch s := src.(type) {
+		case *budgetedSource:
+			return s.budget
+		case *cachedSource:
+			bs, ok := s.PriceSource.(*budgetedSource)
+			if ok {
+				return bs.budget
+			}
+		}
+	}
+	return nil
+}
+
+// The number of sources counting their lookups against the budget
+func meteredCount(sources []PriceSource) int {
+	metered := 0
+	for _, src := range sources {
+		if meteredSources[src.Name()] {
+			metered++
+		}
+	}
+	return metered
+}
+
+// The requests needed to check the entries, one for each metered source
+func requestsNeeded(sources []PriceSource, entries []buylistEntry) int {
+	metered := meteredCount(sources)
+	n := 0
+	for _, entry := range entries {
+		if worthChecking(entry) {
+			n += metered
+		}
+	}
+	return n
+}
+
+// Whether the metered sources have no requests left, so that only the
+// other ones, if any, can still be looked up
+func budgetExhausted(sources []PriceSource) bool {
+	budget := sourcesBudget(sources)
+	return budget != nil && budget.left() == 0
+}
+
+// Tell which entries were left for another day, from the most valuable
+func reportDeferred(deferred []buylistEntry) {
+	if len(deferred) == 0 {
+		return
+	}
+	l := log.New(os.Stderr, "", 0)
+
+	sortByValue(deferred)
+	l.Printf("Daily request budget exhausted, %d entries deferred, buylist prices from %s to %s:",
+		len(deferred), entryValue(deferred[0]), entryValue(deferred[len(deferred)-1]))
+	for i, entry := range deferred {
+		if i == maxReportedDeferred {
+			l.Printf("  and %d more", len(deferred)-i)
+			break
+		}
+		foil := ""
+		if entry.Foil {
+			foil = " foil"
+		}
+		l.Printf("  %s (%s)%s %s", entry.Name, entry.Set, foil, entryValue(entry))
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A row of a vendor buylist, name and set are the vendor ones
+type buylistEntry struct {
+	Name  string
+	Set   string
+	Foil  bool
+	Price Money
+
+	// the condition the price is asked for, NM unless given
+	Condition string
+
+	// empty for English, if the format has a column for it
+	Language string
+
+	// the original row, for error reporting
+	Record []string
+
+	// problems with the row that don't prevent processing it
+	Warns []error
+}
+
+// BuylistSource reads the buylist export of a vendor
+type BuylistSource interface {
+	// Next returns the following entry, or io.EOF at the end
+	Next() (buylistEntry, error)
+
+	// Normalize converts the vendor name and set to the common card
+	// identity, an empty name or set means the entry can be skipped
+	Normalize(entry buylistEntry) (card, error)
+
+	// HasConditions reports whether the entries come with a condition
+	HasConditions() bool
+}
+
+// Buylist formats available in the config, by name
+var buylistFormats = map[string]func(r io.Reader) (BuylistSource, error){}
+
+func registerBuylist(name string, ctor func(r io.Reader) (BuylistSource, error)) {
+	buylistFormats[name] = ctor
+}
+
+func newBuylistSource(name string, r io.Reader) (BuylistSource, error) {
+	ctor, found := buylistFormats[name]
+	if !found {
+		names := make([]string, 0, len(buylistFormats))
+		for name := range buylistFormats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unknown buylist format %q, available: %s", name, strings.Join(names, ", "))
+	}
+	return ctor(r)
+}
+
+// Whether the value of a foil column marks a foil, anything but a blank,
+// "no", "false" or "0" does
+func parseFoil(s string) bool {
+	foil := strings.ToLower(strings.TrimSpace(s))
+	return foil != "" && foil != "no" && foil != "false" && foil != "0"
+}
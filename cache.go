@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Default lifetime of the cached lookups
+const CacheTTL = "1h"
+
+// Past this size the expired entries are dropped
+const maxCacheEntries = 10000
+
+type cacheEntry struct {
+	offers  []offer
+	err     error
+	expires time.Time
+}
+
+// A source remembering its lookups for a while, so that repeated queries
+// for the same card don't hit the server; only the replies and the
+// missing cards are kept, not the errors
+type cachedSource struct {
+	PriceSource
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newCachedSource(src PriceSource, ttl time.Duration) *cachedSource {
+	return &cachedSource{
+		PriceSource: src,
+		ttl:         ttl,
+		entries:     map[string]cacheEntry{},
+	}
+}
+
+func (cs *cachedSource) Lookup(ctx context.Context, c card) ([]offer, error) {
+	key := offerKey(c.Name, c.Set) + "|" + c.Condition + "|" + c.Language
+
+	cs.mu.Lock()
+	entry, found := cs.entries[key]
+	cs.mu.Unlock()
+	if found && time.Now().Before(entry.expires) {
+		return entry.offers, entry.err
+	}
+
+	offers, err := cs.PriceSource.Lookup(ctx, c)
+	if err != nil && err != errCardNotFound {
+		return offers, err
+	}
+
+	cs.mu.Lock()
+	now := time.Now()
+	if len(cs.entries) >= maxCacheEntries {
+		for k, e := range cs.entries {
+			if now.After(e.expires) {
+				delete(cs.entries, k)
+			}
+		}
+	}
+	cs.entries[key] = cacheEntry{offers, err, now.Add(cs.ttl)}
+	cs.mu.Unlock()
+	return offers, err
+}
+
+func (cs *cachedSource) SupportsLanguage(lang string) bool {
+	ls, ok := cs.PriceSource.(LanguageSource)
+	return ok && ls.SupportsLanguage(lang)
+}
+
+// Wrap the metered sources with a cache
+func cacheSources(sources []PriceSource, ttl time.Duration) []PriceSource {
+	wrapped := make([]PriceSource, len(sources))
+	for i, src := range sources {
+		wrapped[i] = src
+		if meteredSources[src.Name()] {
+			wrapped[i] = newCachedSource(src, ttl)
+		}
+	}
+	return wrapped
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The Card Kingdom buylist export, formatted as
+// CK_Key,Card Name,CK_Modif_Set,Set,Rarity,NF/F,MKT_Est,BL_Value
+// optionally followed by a Condition column
+type cardKingdom struct {
+	r       *csv.Reader
+	condIdx int
+}
+
+func init() {
+	registerBuylist("cardkingdom", newCardKingdom)
+}
+
+func newCardKingdom(r io.Reader) (BuylistSource, error) {
+	ck := &cardKingdom{
+		r: csv.NewReader(r),
+	}
+
+	first, err := ck.r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("Empty input file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading record: %s", err.Error())
+	}
+	if len(first) < 8 || (first[1] != "Card Name" &&
+		first[2] != "CK_Modif_Set" && first[5] != "NF/F" &&
+		first[7] != "BL_Value") {
+		return nil, fmt.Errorf("Malformed input file")
+	}
+	ck.condIdx = optionalColumn(first, "Condition")
+	return ck, nil
+}
+
+func (ck *cardKingdom) Next() (buylistEntry, error) {
+	record, err := ck.r.Read()
+	if err != nil {
+		return buylistEntry{}, err
+	}
+
+	var warns []error
+	buylistPrice, err := parseMoney(record[7], BaseCurrency)
+	if err != nil {
+		warns = append(warns, fmt.Errorf("Warning: BL_Value %s %q", err.Error(), record))
+	}
+
+	// rows in an unknown condition are skipped
+	cond := "NM"
+	if ck.condIdx >= 0 {
+		cond, err = parseCondition(record[ck.condIdx])
+		if err != nil {
+			warns = append(warns, fmt.Errorf("Warning: %s %q", err.Error(), record))
+			buylistPrice = Money{}
+		}
+	}
+
+	return buylistEntry{
+		Name:      strings.TrimSpace(record[1]),
+		Set:       strings.TrimSpace(record[2]),
+		Foil:      strings.TrimSpace(record[5]) != "",
+		Price:     buylistPrice,
+		Condition: cond,
+		Record:    record,
+		Warns:     warns,
+	}, nil
+}
+
+func (ck *cardKingdom) HasConditions() bool {
+	return ck.condIdx >= 0
+}
+
+// CK names are converted to CS ones
+func (ck *cardKingdom) Normalize(entry buylistEntry) (card, error) {
+	cardName, cardSet, scryfallID, err := translate(entry.Name, entry.Set)
+	return card{
+		Name:       cardName,
+		Set:        cardSet,
+		Foil:       entry.Foil,
+		ScryfallID: scryfallID,
+		Condition:  entry.Condition,
+		Language:   ckLanguage(entry.Name, entry.Set),
+	}, err
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// CS sets that Cardmarket names differently, in addition to the Scryfall ones
+var mkmSetMap = map[string]string{
+	"Unlimited Edition":     "Unlimited",
+	"Revised Edition":       "Revised",
+	"Classic Sixth Edition": "Sixth Edition",
+}
+
+// A Cardmarket price guide, the guide only has product ids, so a product
+// list with a "Name" and an "Expansion" column is needed as well
+type cardMarket struct {
+	offers map[string][]offer // set|name -> offers
+}
+
+type mkmProduct struct {
+	name      string
+	expansion string
+}
+
+func init() {
+	registerSource("cardmarket", newCardMarket)
+}
+
+func newCardMarket() (PriceSource, error) {
+	if Config.CardmarketFile == "" || Config.CardmarketProductsFile == "" {
+		return nil, fmt.Errorf("Missing cardmarket_file or cardmarket_products_file in %s", ConfigFile)
+	}
+	// fail early rather than on every lookup
+	_, err := Money{Currency: "EUR"}.Convert(BaseCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := loadMKMProducts(Config.CardmarketProductsFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading %s: %s", Config.CardmarketProductsFile, err.Error())
+	}
+
+	file, err := os.Open(Config.CardmarketFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mkm := &cardMarket{
+		offers: map[string][]offer{},
+	}
+	err = mkm.load(file, products)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading %s: %s", Config.CardmarketFile, err.Error())
+	}
+	return mkm, nil
+}
+
+func loadMKMProducts(path string) (map[string]mkmProduct, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := findColumns(header, "idProduct", "Name", "Expansion")
+	if err != nil {
+		return nil, err
+	}
+
+	products := map[string]mkmProduct{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) <= idx[0] || len(record) <= idx[1] || len(record) <= idx[2] {
+			continue
+		}
+		products[strings.TrimSpace(record[idx[0]])] = mkmProduct{
+			name:      strings.TrimSpace(record[idx[1]]),
+			expansion: strings.TrimSpace(record[idx[2]]),
+		}
+	}
+	return products, nil
+}
+
+func (mkm *cardMarket) load(r io.Reader, products map[string]mkmProduct) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	idx, err := findColumns(header, "idProduct", "Trend Price", "Low Price Ex+",
+		"Foil Trend", "Foil Low")
+	if err != nil {
+		return err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		field := func(i int) Money {
+			if idx[i] >= len(record) {
+				return Money{}
+			}
+			value, err := parseMoney(record[idx[i]], "EUR")
+			if err != nil {
+				warnRecord(mkm, err, record)
+			}
+			return value
+		}
+
+		id := strings.TrimSpace(record[idx[0]])
+		product, found := products[id]
+		if !found {
+			continue
+		}
+
+		// the lowest EX+ listing is fine for regular cards, with the trend
+		// as the NM price, while foils are too few for the low price to be
+		// meaningful, and it's only used when there is no trend
+		foilPrice := field(3)
+		if !foilPrice.IsPositive() {
+			foilPrice = field(4)
+		}
+
+		key := offerKey(product.name, product.expansion)
+		url := "https://www.cardmarket.com/en/Magic/Products/Search?idProduct=" + id
+		for _, o := range []offer{
+			{Price: field(2), Condition: "EX"},
+			{Price: field(1)},
+			{Price: foilPrice, Foil: true},
+		} {
+			if !o.Price.IsPositive() {
+				continue
+			}
+			o.Price, err = o.Price.Convert(BaseCurrency)
+			if err != nil {
+				return err
+			}
+			o.Source = mkm.Name()
+			o.URL = url
+			mkm.offers[key] = append(mkm.offers[key], o)
+		}
+	}
+	return nil
+}
+
+func (mkm *cardMarket) Name() string {
+	return "cardmarket"
+}
+
+func (mkm *cardMarket) Lookup(ctx context.Context, c card) ([]offer, error) {
+	offers, found := mkm.offers[offerKey(c.Name, sourceSet(c.Set, mkmSetMap))]
+	if !found {
+		return nil, errCardNotFound
+	}
+	return offers, nil
+}
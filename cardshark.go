@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// The CardShark Get-Price.aspx XML API
+type cardShark struct {
+	userName string
+	apiKey   string
+	client   *http.Client
+}
+
+func init() {
+	registerSource("cardshark", newCardShark)
+}
+
+func newCardShark() (PriceSource, error) {
+	if Config.UserName == "" || Config.ApiKey == "" {
+		return nil, fmt.Errorf("Missing CardShark credentials in %s", ConfigFile)
+	}
+	return &cardShark{
+		userName: Config.UserName,
+		apiKey:   Config.ApiKey,
+		client:   http.DefaultClient,
+	}, nil
+}
+
+func (cs *cardShark) Name() string {
+	return "cardshark"
+}
+
+func (cs *cardShark) Lookup(ctx context.Context, c card) ([]offer, error) {
+	u, err := url.Parse(fmt.Sprintf("http://www.cardshark.com/API/%s/Get-Price.aspx", cs.userName))
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("apiKey", cs.apiKey)
+	q.Set("CardName", c.Name)
+	q.Set("CardSet", c.Set)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cs.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving - %q", err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading - %q", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Error requesting - %q", string(data))
+	}
+
+	var response struct {
+		Status    string `xml:"status"`
+		Price     string `xml:"price"`
+		FoilPrice string `xml:"foilprice"`
+		Url       string `xml:"url"`
+	}
+	err = xml.Unmarshal(data, &response)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding - %q", err)
+	}
+
+	if response.Status != "valid card" {
+		return nil, errCardNotFound
+	}
+	cardCatalogue.add(c.Name, c.Set)
+
+	// some extremenly high prices have a "," so they need parsing
+	marketPrice, marketErr := parseMoney(response.Price, BaseCurrency)
+	foilPrice, foilErr := parseMoney(response.FoilPrice, BaseCurrency)
+
+	return []offer{
+		{Source: cs.Name(), Price: marketPrice, Foil: false, URL: response.Url, Warn: marketErr},
+		{Source: cs.Name(), Price: foilPrice, Foil: true, URL: response.Url, Warn: foilErr},
+	}, nil
+}
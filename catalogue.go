@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Every valid CS name and set pair ever returned, so that translations
+// can be checked without querying CS
+type catalogue struct {
+	mu    sync.Mutex
+	cards map[string]map[string]bool // set -> name -> found
+}
+
+var cardCatalogue = newCatalogue()
+
+func newCatalogue() *catalogue {
+	return &catalogue{
+		cards: map[string]map[string]bool{},
+	}
+}
+
+// A missing file is not an error, it just means nothing was stored yet
+func loadCatalogue(path string) (*catalogue, error) {
+	c := newCatalogue()
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	_, err = c.importDump(file)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading catalogue %s: %s", path, err.Error())
+	}
+	return c, nil
+}
+
+func (c *catalogue) add(cardName, cardSet string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names, found := c.cards[cardSet]
+	if !found {
+		names = map[string]bool{}
+		c.cards[cardSet] = names
+	}
+	names[cardName] = true
+}
+
+func (c *catalogue) has(cardName, cardSet string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cards[cardSet][cardName]
+}
+
+func (c *catalogue) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, names := range c.cards {
+		n += len(names)
+	}
+	return n
+}
+
+// Merge a csv dump in the catalogue, the only requirement is to have a
+// "Name" and a "Set" column, so that the output of a run works too
+func (c *catalogue) importDump(r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	idx, err := findColumns(header, "Name", "Set")
+	if err != nil {
+		return 0, err
+	}
+	nameIdx, setIdx := idx[0], idx[1]
+
+	n := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		if len(record) <= nameIdx || len(record) <= setIdx {
+			continue
+		}
+		cardName := strings.TrimSpace(record[nameIdx])
+		cardSet := strings.TrimSpace(record[setIdx])
+		if cardName == "" || cardSet == "" {
+			continue
+		}
+		c.add(cardName, cardSet)
+		n++
+	}
+	return n, nil
+}
+
+// Return the position of each of the named columns in the header
+func findColumns(header []string, names ...string) ([]int, error) {
+	idx := make([]int, len(names))
+	for i, name := range names {
+		idx[i] = -1
+		for j, field := range header {
+			if strings.TrimSpace(field) == name {
+				idx[i] = j
+				break
+			}
+		}
+		if idx[i] < 0 {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+	return idx, nil
+}
+
+// Write the catalogue sorted by set and name, to keep diffs readable
+func (c *catalogue) save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sets := make([]string, 0, len(c.cards))
+	for set := range c.cards {
+		sets = append(sets, set)
+	}
+	sort.Strings(sets)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(file)
+	w.Write([]string{"Name", "Set"})
+	for _, set := range sets {
+		names := make([]string, 0, len(c.cards[set]))
+		for name := range c.cards[set] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			w.Write([]string{name, set})
+		}
+	}
+	w.Flush()
+
+	err = w.Error()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Configuration is optional for offline commands, the defaults are enough
+func loadOfflineConfig() {
+	err := loadConfig()
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal(err)
+	}
+}
+
+func importCatalogue(args []string) int {
+	if len(args) < 1 {
+		log.Fatal(fmt.Errorf("usage: <exe> import-catalogue <csv>..."))
+	}
+	loadOfflineConfig()
+
+	c, err := loadCatalogue(Config.CatalogueFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	before := c.len()
+
+	for _, path := range args {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, err = c.importDump(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Error importing %s: %s", path, err.Error())
+		}
+	}
+
+	err = c.save(Config.CatalogueFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.New(os.Stderr, "", 0).Printf("Imported %d new cards, %d total", c.len()-before, c.len())
+	return 0
+}
+
+// Buylist entries whose CS card is unknown, as reported by
+// validate-mappings and saved along with the output of a run
+var unmatchedHeader = []string{"Buylist Name", "Buylist Set", "CS Name", "CS Set"}
+
+// Translate every row of a CK buylist and report the ones pointing to a
+// card that CS never returned
+func validateMappings(args []string) int {
+	l := log.New(os.Stderr, "", 0)
+
+	if len(args) < 1 {
+		log.Fatal(fmt.Errorf("usage: <exe> validate-mappings <csv>"))
+	}
+	loadOfflineConfig()
+
+	known, err := loadCatalogue(Config.CatalogueFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if known.len() == 0 {
+		log.Fatal("Empty catalogue, import a dump or run a query first")
+	}
+
+	err = loadScryfallConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	bl, err := newBuylistSource(Config.BuylistFormat, file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	defer w.Flush()
+	w.Write(unmatchedHeader)
+
+	checked, missing := 0, 0
+	for {
+		entry, err := bl.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			l.Printf("Error reading record: %s", err.Error())
+			break
+		}
+
+		c, err := bl.Normalize(entry)
+		if err != nil {
+			l.Printf("Error parsing %q - %q", entry.Record, err)
+			continue
+		} else if c.Name == "" || c.Set == "" {
+			continue
+		}
+
+		checked++
+		if !known.has(c.Name, c.Set) {
+			w.Write([]string{entry.Name, entry.Set, c.Name, c.Set})
+			missing++
+		}
+	}
+
+	l.Printf("%d translations checked, %d not in the catalogue", checked, missing)
+	return 0
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Card conditions from the best one, anything below is not bought by CK
+var conditions = []string{"NM", "EX", "VG", "G"}
+
+// The names used by vendors and marketplaces for the conditions
+var conditionNames = map[string]string{
+	"near mint":         "NM",
+	"mint":              "NM",
+	"excellent":         "EX",
+	"lightly played":    "EX",
+	"very good":         "VG",
+	"moderately played": "VG",
+	"good":              "G",
+	"heavily played":    "G",
+}
+
+// The canonical abbreviation of a condition, a blank one is NM
+func parseCondition(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "NM", nil
+	}
+	for _, cond := range conditions {
+		if strings.EqualFold(s, cond) {
+			return cond, nil
+		}
+	}
+	cond, found := conditionNames[strings.ToLower(s)]
+	if !found {
+		return "", fmt.Errorf("unknown condition %q", s)
+	}
+	return cond, nil
+}
+
+// Position of the condition from the best, an empty one is NM
+func conditionRank(cond string) int {
+	for i, entry := range conditions {
+		if entry == cond {
+			return i
+		}
+	}
+	return 0
+}
+
+// Whether a card in the first condition can be sold as the second one
+func conditionAtLeast(cond, wanted string) bool {
+	return conditionRank(cond) <= conditionRank(wanted)
+}
+
+// The price CK pays for a condition, given the NM one; false if the
+// condition is not bought
+func conditionPrice(price Money, cond string) (Money, bool) {
+	if cond == "" {
+		cond = "NM"
+	}
+	multiplier, found := Config.ConditionMultipliers[cond]
+	if !found || multiplier <= 0 {
+		return Money{}, false
+	}
+	return price.Scale(multiplier), true
+}
+
+// The cheapest offer in each finish among the ones that can be sold in
+// the wanted condition
+func offersInCondition(offers []offer, wanted string) []offer {
+	var usable []offer
+	for _, o := range offers {
+		if conditionAtLeast(o.Condition, wanted) {
+			usable = append(usable, o)
+		}
+	}
+	return cheapestOffers(usable)
+}
+
+// The index of an optional column, -1 if missing
+func optionalColumn(header []string, name string) int {
+	for i, column := range header {
+		if strings.TrimSpace(column) == name {
+			return i
+		}
+	}
+	return -1
+}
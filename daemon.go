@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Default schedule and output of the daemon
+const (
+	DaemonInterval = "24h"
+	ResultsDir     = "results"
+	LockFile       = "cardsharker.lock"
+)
+
+// Make sure a single daemon works in the directory, the lock is held on
+// the file for as long as the daemon lives, so that it goes away with the
+// process even if killed
+func acquireLock(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := tryLockFile(file)
+	if err == nil && !locked {
+		err = fmt.Errorf("Another daemon is running, its pid is in %s", path)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// the file itself stays, removing it would let a daemon that opened
+	// it just before lock a file no other one sees
+	file.Truncate(0)
+	fmt.Fprintf(file, "%d\n", os.Getpid())
+	return func() {
+		file.Close()
+	}, nil
+}
+
+// Run the pipeline on the buylist file, saving the opportunities in the
+// results directory; a cancelled run keeps what it found so far
+func daemonRun(ctx context.Context, sources []PriceSource, path string) error {
+	l := log.New(os.Stderr, "", 0)
+
+	// the sources that are not metered are still worth a run
+	if budgetExhausted(sources) && meteredCount(sources) == len(sources) {
+		l.Println("Daily request budget exhausted, skipping run")
+		return nil
+	}
+
+	err := os.MkdirAll(Config.ResultsDir, 0755)
+	if err != nil {
+		return err
+	}
+	started := time.Now()
+	name := filepath.Join(Config.ResultsDir, started.Format(runIDFormat)+".csv")
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	unmatched, err := os.Create(strings.TrimSuffix(name, ".csv") + "-unmatched.csv")
+	if err != nil {
+		return err
+	}
+	defer unmatched.Close()
+
+	err = arbitrage(ctx, sources, path, time.Time{}, out, unmatched)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		l.Printf("Run stopped, partial results in %s", name)
+	} else if budgetExhausted(sources) {
+		l.Printf("Daily request budget exhausted, partial results in %s", name)
+	} else {
+		l.Printf("Run finished in %s, results in %s", time.Since(started).Round(time.Second), name)
+	}
+	return nil
+}
+
+// Run the pipeline on a schedule, re-reading the buylist every time; a
+// run taking longer than the interval delays the following one instead
+// of overlapping it
+func daemonCmd(args []string) int {
+	l := log.New(os.Stderr, "", 0)
+
+	if len(args) < 1 {
+		log.Fatal(fmt.Errorf("usage: <exe> daemon <csv>"))
+	}
+
+	sources := setup()
+
+	interval, err := time.ParseDuration(Config.DaemonInterval)
+	if err != nil || interval <= 0 {
+		log.Fatal(fmt.Errorf("Invalid daemon_interval %q in %s", Config.DaemonInterval, ConfigFile))
+	}
+
+	unlock, err := acquireLock(Config.LockFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer unlock()
+
+	// a signal stops the run in progress as well as the schedule
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		l.Println("Stopping")
+		cancel()
+	}()
+
+	for {
+		started := time.Now()
+		err := daemonRun(ctx, sources, args[0])
+		if err != nil {
+			l.Println("Error running:", err)
+		}
+		if ctx.Err() != nil {
+			return 0
+		}
+
+		// skip the slots missed by a long run
+		wait := interval - time.Since(started)%interval
+		l.Printf("Next run at %s", time.Now().Add(wait).Format(time.RFC3339))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return 0
+		}
+	}
+}
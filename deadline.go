@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// The time after which no more entries are checked: -max-duration is a
+// Go duration from now, -deadline either a full RFC3339 time or a time of
+// the day, the next one to come
+func runDeadline(maxDuration time.Duration, deadline string) (time.Time, error) {
+	var limit time.Time
+	now := time.Now()
+	if maxDuration > 0 {
+		limit = now.Add(maxDuration)
+	}
+	if deadline == "" {
+		return limit, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, deadline)
+	if err != nil {
+		clock, err := time.ParseInLocation("15:04", deadline, time.Local)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid deadline %q, use 15:04 or %s", deadline, time.RFC3339)
+		}
+		t = time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	if limit.IsZero() || t.Before(limit) {
+		limit = t
+	}
+	return limit, nil
+}
+
+// Whether the deadline, if any, is past
+func pastDeadline(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
+// Tell how much of the buylist was not checked in time, on stderr and as
+// a comment line at the end of the results
+func reportUnchecked(out io.Writer, unchecked []buylistEntry) error {
+	if len(unchecked) == 0 {
+		return nil
+	}
+	note := fmt.Sprintf("Deadline reached, %d entries left unchecked", len(unchecked))
+	log.New(os.Stderr, "", 0).Println(note)
+	_, err := fmt.Fprintf(out, "# %s\n", note)
+	return err
+}
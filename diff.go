@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An arbitrage row of a run, as compared by the diff
+type opportunity struct {
+	card   card
+	spread float64
+}
+
+func (o opportunity) key() string {
+	foil := ""
+	if o.card.Foil {
+		foil = "X"
+	}
+	return strings.Join([]string{
+		foldSet(o.card.Set), foldName(o.card.Name), foil, o.card.Condition, o.card.Language,
+	}, "|")
+}
+
+// The rows of a csv produced by a run, the condition and language are
+// only present in some of them
+func readResults(path string) (map[string]opportunity, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	// time-boxed runs end with a note of the rows left unchecked
+	reader.Comment = '#'
+	header, err := reader.Read()
+	if err == io.EOF {
+		// runs without results don't write a header
+		return map[string]opportunity{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+	idx, err := findColumns(header, "Name", "Set", "Foil", "Spread")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+	condIdx := optionalColumn(header, "Condition")
+	langIdx := optionalColumn(header, "Language")
+
+	rows := map[string]opportunity{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s: %s", path, err.Error())
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		spread, err := strconv.ParseFloat(strings.TrimSuffix(field(idx[3]), "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s: invalid spread %q", path, field(idx[3]))
+		}
+		cond := field(condIdx)
+		if cond == "" {
+			cond = "NM"
+		}
+		o := opportunity{
+			card: card{
+				Name:      field(idx[0]),
+				Set:       field(idx[1]),
+				Foil:      field(idx[2]) != "",
+				Condition: cond,
+				Language:  field(langIdx),
+			},
+			spread: spread,
+		}
+		rows[o.key()] = o
+	}
+	return rows, nil
+}
+
+// The arbitrage rows of a run of the history, computed on the cheapest
+// offer as the run did
+func runRows(path string, run historyRun) (map[string]opportunity, error) {
+	rows := map[string]opportunity{}
+	err := readHistorySpan(path, run.Start, run.End, func(rec historyRecord) {
+		// other runs may have stored prices at the same time
+		if !rec.Time.Equal(run.Time) {
+			return
+		}
+		if !rec.Price.IsPositive() || rec.Price.Currency != rec.BuylistPrice.Currency ||
+			float64(rec.Price.Cents) > Tolerance*float64(rec.BuylistPrice.Cents) {
+			return
+		}
+		arb := rec.BuylistPrice.Sub(rec.Price)
+		o := opportunity{
+			card:   rec.Card,
+			spread: 100 * float64(arb.Cents) / float64(rec.Price.Cents),
+		}
+		old, found := rows[o.key()]
+		if !found || o.spread > old.spread {
+			rows[o.key()] = o
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// The runs of the history of the given kind, or of any if empty, from
+// the oldest
+func sortedRuns(path, kind string) ([]historyRun, error) {
+	stored, err := readRuns(path)
+	if err != nil {
+		return nil, err
+	}
+	var runs []historyRun
+	for _, run := range stored {
+		if kind == "" || run.Kind == kind {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Time.Before(runs[j].Time)
+	})
+	return runs, nil
+}
+
+// The arbitrage rows of the latest full run in the history, none if
+// there is no history yet; the partial and watch runs would make every
+// opportunity they didn't check look new
+func lastRun(path string) (map[string]opportunity, error) {
+	runs, err := sortedRuns(path, fullRun)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return map[string]opportunity{}, nil
+	}
+	rows, err := runRows(path, runs[len(runs)-1])
+	if os.IsNotExist(err) {
+		return map[string]opportunity{}, nil
+	}
+	return rows, err
+}
+
+// Pick two stored runs by their time, or the last two full ones, as a
+// partial run would have most rows vanish
+func selectRuns(runs []historyRun, args []string) (historyRun, historyRun, error) {
+	if len(args) == 0 {
+		var full []historyRun
+		for _, run := range runs {
+			if run.Kind == fullRun {
+				full = append(full, run)
+			}
+		}
+		if len(full) < 2 {
+			return historyRun{}, historyRun{}, fmt.Errorf("Not enough full runs in %s", Config.HistoryFile)
+		}
+		return full[len(full)-2], full[len(full)-1], nil
+	}
+	if len(args) != 2 {
+		return historyRun{}, historyRun{}, fmt.Errorf("usage: <exe> diff -history [<old time> <new time>]")
+	}
+
+	var selected []historyRun
+	for _, arg := range args {
+		ts, err := time.Parse(time.RFC3339, arg)
+		if err != nil {
+			return historyRun{}, historyRun{}, err
+		}
+		found := false
+		for _, run := range runs {
+			if run.Time.Equal(ts) {
+				selected = append(selected, run)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return historyRun{}, historyRun{}, fmt.Errorf("No run at %s in %s", arg, Config.HistoryFile)
+		}
+	}
+	return selected[0], selected[1], nil
+}
+
+var changeOrder = map[string]int{"new": 0, "vanished": 1, "changed": 2}
+
+// Compare the arbitrage rows of two runs, reporting the new ones, the
+// vanished ones, and the ones whose spread moved more than the threshold
+func diffRuns(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	threshold := fs.Float64("threshold", 10, "minimum change of the spread to report, in percentage points")
+	fromHistory := fs.Bool("history", false, "compare two runs stored in the history, by default the last two")
+	fs.Parse(args)
+
+	var old, cur map[string]opportunity
+	var err error
+	if *fromHistory {
+		loadOfflineConfig()
+		runs, err := sortedRuns(Config.HistoryFile, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		oldRun, curRun, err := selectRuns(runs, fs.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		old, err = runRows(Config.HistoryFile, oldRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cur, err = runRows(Config.HistoryFile, curRun)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		if fs.NArg() != 2 {
+			log.Fatal(fmt.Errorf("usage: <exe> diff [-threshold <pp>] <old csv> <new csv>"))
+		}
+		old, err = readResults(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		cur, err = readResults(fs.Arg(1))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	type change struct {
+		kind     string
+		row      opportunity
+		previous string
+		current  string
+	}
+	var changes []change
+	spread := func(value float64) string {
+		return fmt.Sprintf("%0.2f%%", value)
+	}
+	for key, row := range cur {
+		prev, found := old[key]
+		if !found {
+			changes = append(changes, change{"new", row, "", spread(row.spread)})
+		} else if math.Abs(row.spread-prev.spread) >= *threshold {
+			changes = append(changes, change{"changed", row, spread(prev.spread), spread(row.spread)})
+		}
+	}
+	for key, row := range old {
+		_, found := cur[key]
+		if !found {
+			changes = append(changes, change{"vanished", row, spread(row.spread), ""})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].kind != changes[j].kind {
+			return changeOrder[changes[i].kind] < changeOrder[changes[j].kind]
+		}
+		if changes[i].row.card.Set != changes[j].row.card.Set {
+			return changes[i].row.card.Set < changes[j].row.card.Set
+		}
+		return changes[i].row.card.Name < changes[j].row.card.Name
+	})
+
+	w := csv.NewWriter(os.Stdout)
+	defer w.Flush()
+	w.Write([]string{"Change", "Name", "Set", "Foil", "Condition", "Language", "Old Spread", "New Spread"})
+	for _, c := range changes {
+		foil := ""
+		if c.row.card.Foil {
+			foil = "X"
+		}
+		w.Write([]string{
+			c.kind,
+			c.row.card.Name,
+			c.row.card.Set,
+			foil,
+			c.row.card.Condition,
+			c.row.card.Language,
+			c.previous,
+			c.current,
+		})
+	}
+	return 0
+}
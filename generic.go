@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A buylist with a "Name", "Set", "Foil" and "Price" column, in any order,
+// using the card and set names of Scryfall and MTGJSON, and an optional
+// "Condition" and "Language" one
+type genericBuylist struct {
+	r       *csv.Reader
+	idx     []int
+	condIdx int
+	langIdx int
+}
+
+func init() {
+	registerBuylist("generic", newGenericBuylist)
+}
+
+func newGenericBuylist(r io.Reader) (BuylistSource, error) {
+	gb := &genericBuylist{
+		r: csv.NewReader(r),
+	}
+	gb.r.FieldsPerRecord = -1
+
+	header, err := gb.r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("Empty input file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading record: %s", err.Error())
+	}
+	gb.idx, err = findColumns(header, "Name", "Set", "Foil", "Price")
+	if err != nil {
+		return nil, fmt.Errorf("Malformed input file: %s", err.Error())
+	}
+	gb.condIdx = optionalColumn(header, "Condition")
+	gb.langIdx = optionalColumn(header, "Language")
+	return gb, nil
+}
+
+func (gb *genericBuylist) Next() (buylistEntry, error) {
+	record, err := gb.r.Read()
+	if err != nil {
+		return buylistEntry{}, err
+	}
+	field := func(i int) string {
+		if gb.idx[i] >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[gb.idx[i]])
+	}
+
+	var warns []error
+	buylistPrice, err := parseMoney(field(3), BaseCurrency)
+	if err != nil {
+		warns = append(warns, fmt.Errorf("Warning: Price %s %q", err.Error(), record))
+	}
+
+	// rows in an unknown condition are skipped
+	cond := "NM"
+	if gb.condIdx >= 0 && gb.condIdx < len(record) {
+		cond, err = parseCondition(record[gb.condIdx])
+		if err != nil {
+			warns = append(warns, fmt.Errorf("Warning: %s %q", err.Error(), record))
+			buylistPrice = Money{}
+		}
+	}
+
+	lang := ""
+	if gb.langIdx >= 0 && gb.langIdx < len(record) {
+		lang, err = parseLanguage(record[gb.langIdx])
+		if err != nil {
+			warns = append(warns, fmt.Errorf("Warning: %s %q", err.Error(), record))
+			buylistPrice = Money{}
+		}
+	}
+
+	return buylistEntry{
+		Name:      field(0),
+		Set:       field(1),
+		Foil:      parseFoil(field(2)),
+		Price:     buylistPrice,
+		Condition: cond,
+		Language:  lang,
+		Record:    record,
+		Warns:     warns,
+	}, nil
+}
+
+func (gb *genericBuylist) HasConditions() bool {
+	return gb.condIdx >= 0
+}
+
+// Canonical names only need the CS spelling
+func (gb *genericBuylist) Normalize(entry buylistEntry) (card, error) {
+	if entry.Name == "" || entry.Set == "" || skipCard(entry.Name, entry.Set) {
+		return card{}, nil
+	}
+	cardSet := canonicalCSSet(entry.Set)
+	return card{
+		Name:      csCardName(entry.Name, cardSet),
+		Set:       cardSet,
+		Foil:      entry.Foil,
+		Condition: entry.Condition,
+		Language:  entry.Language,
+	}, nil
+}
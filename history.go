@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default location of the price history
+const HistoryFile = "history.csv"
+
+var historyHeader = []string{
+	"Time", "Name", "Set", "Foil", "Condition", "Language",
+	"Source", "Price", "Buylist Price", "Currency",
+}
+
+// A price fetched during a run, along with the buylist one, the time
+// identifies the run
+type historyRecord struct {
+	Time         time.Time
+	Card         card
+	Source       string
+	Price        Money
+	BuylistPrice Money
+}
+
+// The price history is a csv that every run appends to, so that nothing
+// already stored is ever rewritten; the records of a result are written
+// at once under a lock, as other processes may append at the same time.
+// Where the records of each run lie in the file is kept in an index next
+// to it, so that a run is read without going through the whole history
+type history struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+
+	// the run being stored, and the offsets of its first record and past
+	// its last one, start is -1 until a record is written
+	run        time.Time
+	start, end int64
+}
+
+// The index of the runs, one line per run that stored any price
+var runsHeader = []string{"Time", "Kind", "Start", "End"}
+
+// The kinds of runs, a full run checked the whole buylist, so only those
+// tell which opportunities are new
+const (
+	fullRun    = "full"
+	partialRun = "partial"
+	watchRun   = "watch"
+)
+
+func runsPath(path string) string {
+	return path + ".runs"
+}
+
+func openHistory(path string) (*history, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = appendCSV(file, historyHeader, nil)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &history{path: path, file: file, start: -1}, nil
+}
+
+// Append the records to a csv that other processes may append to, with
+// the header first when the file is still empty; returns the offsets of
+// the first record and past the last one
+func appendCSV(file *os.File, header []string, records [][]string) (int64, int64, error) {
+	err := lockFile(file, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlockFile(file)
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if info.Size() == 0 {
+		w.Write(header)
+		w.Flush()
+	} else {
+		// a write cut short by a crash is ended first, to keep its
+		// damage to its own line
+		last := make([]byte, 1)
+		_, err = file.ReadAt(last, info.Size()-1)
+		if err != nil {
+			return 0, 0, err
+		}
+		if last[0] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	start := info.Size() + int64(buf.Len())
+	w.WriteAll(records)
+	err = w.Error()
+	if err != nil {
+		return 0, 0, err
+	}
+	if buf.Len() == 0 {
+		return start, start, nil
+	}
+	_, err = file.Write(buf.Bytes())
+	return start, info.Size() + int64(buf.Len()), err
+}
+
+func (rec historyRecord) csv() []string {
+	foil := ""
+	if rec.Card.Foil {
+		foil = "X"
+	}
+	return []string{
+		rec.Time.UTC().Format(time.RFC3339),
+		rec.Card.Name,
+		rec.Card.Set,
+		foil,
+		rec.Card.Condition,
+		rec.Card.Language,
+		rec.Source,
+		rec.Price.String(),
+		rec.BuylistPrice.String(),
+		rec.Price.Currency,
+	}
+}
+
+// Store every priced offer of a result
+func (h *history) addResult(started time.Time, r result) error {
+	var records [][]string
+	for _, o := range r.offers {
+		records = append(records, historyRecord{
+			Time:         started,
+			Card:         r.card,
+			Source:       o.Source,
+			Price:        o.Price,
+			BuylistPrice: r.buylistPrice,
+		}.csv())
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	start, end, err := appendCSV(h.file, historyHeader, records)
+	if err != nil {
+		return err
+	}
+	if h.start < 0 {
+		h.run, h.start = started, start
+	}
+	h.end = end
+	return nil
+}
+
+// Add the run to the index as the given kind, if it stored anything, and
+// close the history
+func (h *history) Close(kind string) error {
+	err := h.file.Close()
+	if err != nil || h.start < 0 {
+		return err
+	}
+
+	index, err := os.OpenFile(runsPath(h.path), os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	_, _, err = appendCSV(index, runsHeader, [][]string{{
+		h.run.UTC().Format(time.RFC3339),
+		kind,
+		strconv.FormatInt(h.start, 10),
+		strconv.FormatInt(h.end, 10),
+	}})
+	if err != nil {
+		return err
+	}
+	return index.Close()
+}
+
+// A run of the index, with the part of the history holding its records,
+// along with the ones of other runs made at the same time
+type historyRun struct {
+	Time       time.Time
+	Kind       string
+	Start, End int64
+}
+
+// The runs of the index, in the order they ended; none if there is no
+// index yet
+func readRuns(path string) ([]historyRun, error) {
+	file, err := os.Open(runsPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	err = lockFile(file, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockFile(file)
+
+	var runs []historyRun
+	err = scanCSV(runsPath(path), file, 0, func(offset int64, record []string) error {
+		if len(record) < len(runsHeader) {
+			return fmt.Errorf("missing fields")
+		}
+		ts, err := time.Parse(time.RFC3339, record[0])
+		if err != nil {
+			return err
+		}
+		start, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		end, err := strconv.ParseInt(record[3], 10, 64)
+		if err != nil {
+			return err
+		}
+		runs = append(runs, historyRun{ts, record[1], start, end})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", runsPath(path), err.Error())
+	}
+	return runs, nil
+}
+
+// Call fn with the csv records of r, offset being the position of r in
+// the file at path, whose header is skipped; each line is parsed on its own, so that a
+// torn one with an open quote doesn't swallow the following ones, and the
+// lines that can't be read, such as the ones cut short by a crash, are
+// skipped with a single warning
+func scanCSV(path string, r io.Reader, offset int64, fn func(offset int64, record []string) error) error {
+	skipped := 0
+	var firstErr error
+	lines := bufio.NewScanner(r)
+	lines.Buffer(nil, 1024*1024)
+	for ; lines.Scan(); offset += int64(len(lines.Bytes())) + 1 {
+		if len(lines.Bytes()) == 0 || offset == 0 {
+			continue
+		}
+		reader := csv.NewReader(bytes.NewReader(lines.Bytes()))
+		reader.FieldsPerRecord = -1
+		record, err := reader.Read()
+		if err == nil {
+			err = fn(offset, record)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("at byte %d: %s", offset, err.Error())
+			}
+			skipped++
+		}
+	}
+	if lines.Err() != nil {
+		return lines.Err()
+	}
+	if skipped > 0 {
+		l := log.New(os.Stderr, "", 0)
+		l.Printf("Warning: skipped %d unreadable lines of %s, the first %s", skipped, path, firstErr.Error())
+	}
+	return nil
+}
+
+// Read the records of the history in the order they were stored
+func readHistory(path string, fn func(rec historyRecord)) error {
+	return readHistorySpan(path, 0, -1, fn)
+}
+
+// Read the records stored between the two offsets of the history, up to
+// its end if end is negative
+func readHistorySpan(path string, start, end int64, fn func(rec historyRecord)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = lockFile(file, false)
+	if err != nil {
+		return err
+	}
+	defer unlockFile(file)
+
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+	header, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+	idx, err := findColumns(header, historyHeader...)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+	columns := 0
+	for _, i := range idx {
+		if i >= columns {
+			columns = i + 1
+		}
+	}
+
+	if start < int64(len(line)) {
+		start = int64(len(line))
+	}
+	_, err = file.Seek(start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = file
+	if end >= 0 {
+		r = io.LimitReader(file, end-start)
+	}
+	err = scanCSV(path, r, start, func(offset int64, record []string) error {
+		if len(record) < columns {
+			return fmt.Errorf("missing fields")
+		}
+		ts, err := time.Parse(time.RFC3339, record[idx[0]])
+		if err != nil {
+			return err
+		}
+		currency := record[idx[9]]
+		price, err := parseMoney(record[idx[7]], currency)
+		if err != nil {
+			return err
+		}
+		buylistPrice, err := parseMoney(record[idx[8]], currency)
+		if err != nil {
+			return err
+		}
+
+		fn(historyRecord{
+			Time: ts,
+			Card: card{
+				Name:      record[idx[1]],
+				Set:       record[idx[2]],
+				Foil:      record[idx[3]] != "",
+				Condition: record[idx[4]],
+				Language:  record[idx[5]],
+			},
+			Source:       record[idx[6]],
+			Price:        price,
+			BuylistPrice: buylistPrice,
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+	return nil
+}
+
+// The stored prices of a card, in any set if empty, from the oldest
+func cardHistory(path, cardName, cardSet string) ([]historyRecord, error) {
+	var records []historyRecord
+	err := readHistory(path, func(rec historyRecord) {
+		if !sameName(rec.Card.Name, cardName) {
+			return
+		}
+		if cardSet != "" && !sameName(rec.Card.Set, cardSet) {
+			return
+		}
+		records = append(records, rec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records, nil
+}
+
+// Print the stored prices of a card, optionally restricted to a set, from
+// the oldest
+func historyCmd(args []string) int {
+	if len(args) < 1 {
+		log.Fatal(fmt.Errorf("usage: <exe> history <card name> [set]"))
+	}
+
+	loadOfflineConfig()
+
+	cardSet := ""
+	if len(args) > 1 {
+		cardSet = args[1]
+	}
+	records, err := cardHistory(Config.HistoryFile, args[0], cardSet)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	defer w.Flush()
+	w.Write([]string{"Time", "Set", "Foil", "Condition", "Language", "Source", "Price", "Buylist Price", "Spread"})
+	for _, rec := range records {
+		foil := ""
+		if rec.Card.Foil {
+			foil = "X"
+		}
+		spread := ""
+		if rec.Price.IsPositive() && rec.Price.Currency == rec.BuylistPrice.Currency {
+			arb := rec.BuylistPrice.Sub(rec.Price)
+			spread = fmt.Sprintf("%0.2f%%", 100*float64(arb.Cents)/float64(rec.Price.Cents))
+		}
+		w.Write([]string{
+			rec.Time.UTC().Format(time.RFC3339),
+			rec.Card.Set,
+			foil,
+			rec.Card.Condition,
+			rec.Card.Language,
+			rec.Source,
+			rec.Price.String(),
+			rec.BuylistPrice.String(),
+			spread,
+		})
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Languages use the Scryfall codes, English is left empty as it's the
+// default everywhere; LangOther is a non-English card of unknown language
+const LangOther = "other"
+
+// The names used by vendors for the languages
+var languageNames = map[string]string{
+	"english":             "",
+	"en":                  "",
+	"japanese":            "ja",
+	"jp":                  "ja",
+	"jpn":                 "ja",
+	"german":              "de",
+	"french":              "fr",
+	"italian":             "it",
+	"spanish":             "es",
+	"portuguese":          "pt",
+	"russian":             "ru",
+	"korean":              "ko",
+	"chinese simplified":  "zhs",
+	"chinese traditional": "zht",
+	"non-english":         LangOther,
+}
+
+// The language code of a vendor name or code
+func parseLanguage(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return "", nil
+	}
+	lang, found := languageNames[s]
+	if found {
+		return lang, nil
+	}
+	for _, code := range languageNames {
+		if s == code {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("unknown language %q", s)
+}
+
+// The language of a CK card, from the set or the name qualifiers
+func ckLanguage(cardName, cardSet string) string {
+	if strings.Contains(cardSet, "JPN") {
+		return "ja"
+	}
+	qualifier := ""
+	idx := strings.Index(cardName, " (")
+	if idx >= 0 {
+		qualifier = strings.ToLower(cardName[idx:])
+	}
+	switch {
+	case strings.Contains(qualifier, "non-english"):
+		return LangOther
+	case strings.Contains(qualifier, "jpn"), strings.Contains(qualifier, "japanese"):
+		return "ja"
+	}
+	return ""
+}
+
+// LanguageSource is a PriceSource that can price non-English cards,
+// sources not implementing it only list English ones: CardShark and the
+// Cardmarket price guide don't tell languages apart, TCGplayer does when
+// its csv has a "Language" column
+type LanguageSource interface {
+	SupportsLanguage(lang string) bool
+}
+
+// Whether the source prices some non-English cards, looking through the
+// cache and budget wrappers
+func multilingual(src PriceSource) bool {
+	ls, ok := src.(LanguageSource)
+	if !ok {
+		return false
+	}
+	for _, lang := range languageNames {
+		if lang != "" && ls.SupportsLanguage(lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// The sources able to price a card in the given language
+func languageSources(sources []PriceSource, lang string) []PriceSource {
+	if lang == "" {
+		return sources
+	}
+	var supported []PriceSource
+	for _, src := range sources {
+		ls, ok := src.(LanguageSource)
+		if ok && ls.SupportsLanguage(lang) {
+			supported = append(supported, src)
+		}
+	}
+	return supported
+}
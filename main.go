@@ -1,19 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
-	"encoding/xml"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"strconv"
-	"strings"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Minimum difference between market and buylist price
@@ -27,179 +26,345 @@ const MaxConcurrency = 8
 
 const ConfigFile = "cfg.json"
 
-var Config struct {
-	ApiKey   string `json:"api_key"`
-	UserName string `json:"user_name"`
+// Default location of the CS catalogue snapshot
+const CatalogueFile = "catalogue.csv"
+
+type config struct {
+	ApiKey        string   `json:"api_key"`
+	UserName      string   `json:"user_name"`
+	CatalogueFile string   `json:"catalogue_file"`
+	ScryfallFile  string   `json:"scryfall_file"`
+	PriceSource   string   `json:"price_source"`
+	PriceSources  []string `json:"price_sources"`
+	BuylistFormat string   `json:"buylist_format"`
+	TCGplayerFile string   `json:"tcgplayer_file"`
+
+	CardmarketFile         string `json:"cardmarket_file"`
+	CardmarketProductsFile string `json:"cardmarket_products_file"`
+
+	// value in USD of one unit of each currency
+	ExchangeRates map[string]float64 `json:"exchange_rates"`
+
+	// set category -> how the finish to price is chosen
+	PricePolicies map[string]string `json:"price_policies"`
+
+	// condition -> fraction of the NM buylist price paid by CK
+	ConditionMultipliers map[string]float64 `json:"condition_multipliers"`
+
+	// "skip" or "flag" the non-English cards no source can price
+	NonEnglish string `json:"non_english"`
+
+	// prices fetched by every run, empty to disable
+	HistoryFile string `json:"history_file"`
+
+	// where to send the new opportunities
+	Notify *notifyConfig `json:"notify"`
+
+	// schedule of the daemon, as a Go duration, and where it keeps the
+	// output of each run
+	DaemonInterval string `json:"daemon_interval"`
+	ResultsDir     string `json:"results_dir"`
+	LockFile       string `json:"lock_file"`
+
+	// maximum CardShark requests per day, 0 for none, and the file
+	// counting them
+	DailyRequests int    `json:"daily_requests"`
+	QuotaFile     string `json:"quota_file"`
+
+	// check the entries from the highest buylist price instead of in file
+	// order, which matters when the run doesn't go through all of them
+	SortByValue bool `json:"sort_by_value"`
+
+	// address of the server, and how long it remembers the lookups
+	ServeAddr string `json:"serve_addr"`
+	CacheTTL  string `json:"cache_ttl"`
+}
+
+// Anything not present in the config file keeps these defaults
+var Config = config{
+	CatalogueFile:  CatalogueFile,
+	PriceSource:    "cardshark",
+	BuylistFormat:  "cardkingdom",
+	NonEnglish:     "skip",
+	HistoryFile:    HistoryFile,
+	DaemonInterval: DaemonInterval,
+	ResultsDir:     ResultsDir,
+	LockFile:       LockFile,
+	QuotaFile:      QuotaFile,
+	ServeAddr:      ServeAddr,
+	CacheTTL:       CacheTTL,
+	ConditionMultipliers: map[string]float64{
+		"NM": 1,
+		"EX": 0.8,
+		"VG": 0.6,
+		"G":  0.4,
+	},
+}
+
+// Subcommands, anything else is treated as the input csv
+var commands = map[string]func(args []string) int{
+	"daemon":            daemonCmd,
+	"diff":              diffRuns,
+	"watch":             watchCmd,
+	"history":           historyCmd,
+	"import-catalogue":  importCatalogue,
+	"mtgjson":           mtgjsonTablesCmd,
+	"mtgjson-diff":      mtgjsonDiff,
+	"reverse":           reverseCards,
+	"serve":             serveCmd,
+	"validate-mappings": validateMappings,
 }
 
 type result struct {
 	err error
 
-	cardName     string
-	cardSet      string
-	price        float64
-	buylistPrice float64
-	isFoil       bool
-	url          string
+	// errors that did not prevent the lookup
+	warns []error
+
+	cardName      string
+	cardSet       string
+	price         Money
+	buylistPrice  Money
+	isFoil        bool
+	condition     string
+	language      string
+	url           string
+	scryfallID    string
+	source        string
+	runnerUp      string
+	runnerUpPrice Money
+
+	// every priced offer, from the cheapest, for the history
+	card   card
+	offers []offer
+
+	// the buylist and CS name and set of an entry no source knows
+	unmatched []string
+
+	// the entry left for another day when the budget ran out, the result
+	// holds the offers of the sources that are not metered, if any
+	deferred *buylistEntry
 }
 
-func processEntry(record []string) (ret result) {
-	var err error
-	cardName := strings.TrimSpace(record[1])
-	cardSet := strings.TrimSpace(record[2])
-	isFoil := strings.TrimSpace(record[5]) != ""
-	buylistPrice, _ := strconv.ParseFloat(record[7], 64)
-	if strings.HasPrefix(record[7], "$") {
-		buylistPrice, _ = strconv.ParseFloat(record[7][1:], 64)
+func processEntry(ctx context.Context, sources []PriceSource, bl BuylistSource, entry buylistEntry) (ret result) {
+	record := entry.Record
+	ret.warns = entry.Warns
+
+	// the buylist price is the NM one
+	buylistPrice, bought := conditionPrice(entry.Price, entry.Condition)
+	if !bought {
+		ret.warns = append(ret.warns, fmt.Errorf("Warning: condition %s is not bought %q", entry.Condition, record))
+		return
 	}
+	entry.Price = buylistPrice
 
 	// skip small BL under this
-	if buylistPrice < Threshold {
+	if entry.Price.Float() < Threshold {
 		return
 	}
 
-	// convert the CK name and set to CS versions
-	cardName, cardSet, err = processRecord(cardName, cardSet)
+	// convert the vendor name and set to the common ones
+	c, err := bl.Normalize(entry)
 	if err != nil {
 		ret.err = fmt.Errorf("Error parsing %q - %q\n", record, err)
 		return
-	} else if cardName == "" || cardSet == "" {
+	} else if c.Name == "" || c.Set == "" {
 		return
 	}
 
-	u, err := url.Parse(fmt.Sprintf("http://www.cardshark.com/API/%s/Get-Price.aspx", Config.UserName))
-	if err != nil {
-		ret.err = err
-		return
+	// non-English cards are only priced by the sources telling them apart,
+	// unless they are to be flagged and priced as English ones
+	lookup := languageSources(sources, c.Language)
+	if len(lookup) == 0 {
+		if Config.NonEnglish != "flag" {
+			ret.warns = append(ret.warns, fmt.Errorf("Warning: no price source for language %q, skipping %q", c.Language, record))
+			return
+		}
+		lookup = sources
 	}
-	q := u.Query()
-	q.Set("apiKey", Config.ApiKey)
-	q.Set("CardName", cardName)
-	q.Set("CardSet", cardSet)
-	u.RawQuery = q.Encode()
 
-	resp, err := http.Get(u.String())
-	if err != nil {
-		ret.err = fmt.Errorf("Error retrieving %q - %q\n", record, err)
-		return
-	}
-	data, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		ret.err = fmt.Errorf("Error reading %q - %q\n", record, err)
-		return
-	}
-	if resp.StatusCode != 200 {
-		ret.err = fmt.Errorf("Error requesting %q - %q\n", record, string(data))
-		return
+	policy := pricePolicy(c.Set)
+	var quotes []offer
+	var errs []error
+	notFound := 0
+	for i, reply := range lookupAll(ctx, lookup, c) {
+		if reply.err == errBudgetExhausted {
+			// not looked up by this source, as if the run had stopped
+			// before it
+			ret.deferred = &entry
+			continue
+		}
+		if reply.err == errCardNotFound {
+			notFound++
+			continue
+		} else if reply.err != nil {
+			err := fmt.Errorf("%s %q\n", reply.err.Error(), record)
+			if len(sources) > 1 {
+				err = fmt.Errorf("%s: %s", lookup[i].Name(), err.Error())
+			}
+			errs = append(errs, err)
+			continue
+		}
+		for _, o := range reply.offers {
+			if o.Warn != nil && policyFinish(policy, c.Foil, o.Foil) {
+				ret.warns = append(ret.warns, fmt.Errorf("Warning: %s %s %q", lookup[i].Name(), o.Warn.Error(), record))
+			}
+		}
+		quote := selectOffer(offersInCondition(reply.offers, c.Condition), c)
+		if quote.Price.IsPositive() {
+			quote.Price, err = quote.Price.Convert(entry.Price.Currency)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		quotes = append(quotes, quote)
 	}
 
-	var response struct {
-		Status    string `xml:"status"`
-		Price     string `xml:"price"`
-		FoilPrice string `xml:"foilprice"`
-		Url       string `xml:"url"`
-	}
-	err = xml.Unmarshal(data, &response)
-	if err != nil {
-		ret.err = fmt.Errorf("Error decoding %q - %q\n", record, err)
+	// the run was cancelled, the entry was not really looked up
+	if ctx.Err() != nil {
 		return
 	}
 
-	// check for missing prerelease cards and wrong foil prices
-	isPrerelease := cardSet == "Prerelease Stamped"
-
-	if response.Status != "valid card" {
-		isConspiracy := cardSet == "Conspiracy Take the Crown"
-		isSunCe := cardName == "Sun Ce, Young Conquerer"
+	// check for missing prerelease cards
+	if notFound == len(lookup) {
+		isPrerelease := c.Set == "Prerelease Stamped"
+		isConspiracy := c.Set == "Conspiracy Take the Crown"
+		isSunCe := c.Name == "Sun Ce, Young Conquerer"
 
 		// skip errors for missing prerelease cards, CSP2-only
 		// conspiracies, and a single p3k card
 		if !isPrerelease && !isConspiracy && !isSunCe {
-			ret.err = fmt.Errorf("Invalid record: (%s/%s) %q\n", cardName, cardSet, record)
+			ret.err = fmt.Errorf("Invalid record: (%s/%s) %q\n", c.Name, c.Set, record)
+			ret.unmatched = []string{entry.Name, entry.Set, c.Name, c.Set}
 		}
 		return
+	} else if len(quotes) == 0 {
+		// none of the sources that were not skipped knows the card
+		if len(errs) == 0 {
+			return
+		}
+		ret.err = errs[0]
+		ret.warns = append(ret.warns, errs[1:]...)
+		return
 	}
-
-	// handle foil pricing differently for promos
-	isPromo := strings.HasPrefix(cardSet, "Promotional")
-
-	// this roundabout way is because some extremenly high prices have a ","
-	// which prevents correct unmarshaling
-	marketPrice, _ := strconv.ParseFloat(strings.Replace(response.Price, ",", "", -1), 64)
-	foilPrice, _ := strconv.ParseFloat(strings.Replace(response.FoilPrice, ",", "", -1), 64)
-
-	price := marketPrice
-	if isFoil {
-		price = foilPrice
+	ret.warns = append(ret.warns, errs...)
+
+	ret.cardName = c.Name
+	ret.cardSet = c.Set
+	ret.buylistPrice = entry.Price
+	ret.isFoil = c.Foil
+	ret.condition = entry.Condition
+	ret.language = c.Language
+	ret.scryfallID = c.ScryfallID
+
+	ranked := rankOffers(quotes)
+	ret.card = c
+	ret.offers = ranked
+	if len(ranked) > 0 {
+		ret.price = ranked[0].Price
+		ret.url = ranked[0].URL
+		ret.source = ranked[0].Source
 	}
-	// can't trust the promos, pick the lowest among the two prices
-	if isPromo || isPrerelease {
-		price = foilPrice
-		if price-foilPrice > 0 {
-			price = marketPrice
-		}
+	if len(ranked) > 1 {
+		ret.runnerUp = ranked[1].Source
+		ret.runnerUpPrice = ranked[1].Price
 	}
-
-	ret.cardName = cardName
-	ret.cardSet = cardSet
-	ret.price = price
-	ret.buylistPrice = buylistPrice
-	ret.isFoil = isFoil
-	ret.url = response.Url
 	return
 }
 
-func run() int {
-	l := log.New(os.Stderr, "", 0)
-
-	if len(os.Args) < 2 {
-		log.Fatal(fmt.Errorf("usage: <exe> <csv>"))
+func loadConfig() error {
+	data, err := ioutil.ReadFile(ConfigFile)
+	if err != nil {
+		return err
 	}
+	return json.Unmarshal(data, &Config)
+}
 
-	data, err := ioutil.ReadFile(ConfigFile)
+// Load the config and everything the lookups depend on, shared by every
+// command running the pipeline
+func setup() []PriceSource {
+	err := loadConfig()
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = json.Unmarshal(data, &Config)
+
+	err = validatePolicies()
 	if err != nil {
 		log.Fatal(err)
 	}
+	if Config.NonEnglish != "skip" && Config.NonEnglish != "flag" {
+		log.Fatal(fmt.Errorf("Unknown non_english %q, available: skip, flag", Config.NonEnglish))
+	}
+	// the history tells the new opportunities apart, without it every run
+	// would notify all of them again
+	if Config.Notify != nil && Config.HistoryFile == "" {
+		log.Fatal(fmt.Errorf("notify needs a history_file in %s", ConfigFile))
+	}
 
-	file, err := os.Open(os.Args[1])
+	cardCatalogue, err = loadCatalogue(Config.CatalogueFile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	r := csv.NewReader(file)
-	first, err := r.Read()
-	if err == io.EOF {
-		log.Fatal("Empty input file")
-	}
+	err = loadScryfallConfig()
 	if err != nil {
-		log.Fatal("Error reading record: " + err.Error())
+		log.Fatal(err)
 	}
-	if len(first) < 8 || (first[1] != "Card Name" &&
-		first[2] != "CK_Modif_Set" && first[5] != "NF/F" &&
-		first[7] != "BL_Value") {
-		log.Fatal("Malformed input file")
+
+	names := Config.PriceSources
+	if len(names) == 0 {
+		names = []string{Config.PriceSource}
+	}
+	var sources []PriceSource
+	for _, name := range names {
+		src, err := newPriceSource(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sources = append(sources, src)
 	}
 
-	w := csv.NewWriter(os.Stdout)
-	defer w.Flush()
+	// the requests are counted even with no limit
+	return budgetSources(sources, newRequestBudget(Config.QuotaFile, Config.DailyRequests))
+}
 
-	entries := 0
-	records := make(chan []string)
+// Process every entry of the buylist, fn is called with each result from
+// the calling goroutine; the entries left unchecked because the request
+// budget ran out are returned, as well as the ones not dispatched before
+// the deadline, if any
+func processAll(ctx context.Context, sources []PriceSource, bl BuylistSource, deadline time.Time, fn func(result)) (deferred, unchecked []buylistEntry) {
+	l := log.New(os.Stderr, "", 0)
+
+	// an entry along with the requests reserved for it, if any
+	type job struct {
+		ctx    context.Context
+		record buylistEntry
+		res    *reservation
+	}
+	records := make(chan job)
 	results := make(chan result)
 	var wg sync.WaitGroup
 
+	// one per reservation given back, there are never more in flight
+	// than the workers and the dispatcher hold
+	released := make(chan struct{}, MaxConcurrency+1)
+
 	// Read from the records channel and block the subroutine until done
 	// In this way you process entry up to MaxConcurrency at the same time
 	for i := 0; i < MaxConcurrency; i++ {
 		wg.Add(1)
 		go func() {
-			for record := range records {
-				results <- processEntry(record)
+			for j := range records {
+				ret := processEntry(j.ctx, sources, bl, j.record)
+				if j.res != nil {
+					err := j.res.release()
+					if err != nil {
+						ret.warns = append(ret.warns, fmt.Errorf("Error releasing requests: %s", err.Error()))
+					}
+					released <- struct{}{}
+				}
+				results <- ret
 			}
 			wg.Done()
 		}()
@@ -207,10 +372,67 @@ func run() int {
 
 	// Read from input file and queue records to be processed
 	// Close channels and wait group when done
-	// In case of error, wait for any remaining background routines
+	// In case of error or cancellation, wait for any remaining background routines
+	var skipped []buylistEntry
 	go func() {
-		for {
-			record, err := r.Read()
+		// the requests go to the most valuable entries first if they
+		// can't all be checked
+		budget := sourcesBudget(sources)
+		metered := meteredCount(sources)
+		next := bl.Next
+		if Config.SortByValue || budget != nil && budget.left() >= 0 {
+			entries, err := readEntries(bl)
+			if Config.SortByValue || requestsNeeded(sources, entries) > budget.left() {
+				sortByValue(entries)
+			}
+			next = func() (buylistEntry, error) {
+				// a reading error stops the run after the entries read
+				// before it
+				if len(entries) == 0 {
+					return buylistEntry{}, err
+				}
+				entry := entries[0]
+				entries = entries[1:]
+				return entry, nil
+			}
+		}
+		// the requests are taken here, in the order of the entries, so that
+		// the workers can't give them to cheaper ones; when none is left
+		// the entries in flight may still give some back, as when they
+		// are skipped, so they are waited for before giving up
+		inFlight := 0
+		reserve := func(record buylistEntry) (job, error) {
+			j := job{ctx: ctx, record: record}
+			for {
+				for drained := false; !drained; {
+					select {
+					case <-released:
+						inFlight--
+					default:
+						drained = true
+					}
+				}
+				var err error
+				j.ctx, j.res, err = budget.reserve(ctx, metered)
+				if err == nil {
+					inFlight++
+				}
+				if err != errBudgetExhausted || inFlight == 0 {
+					return j, err
+				}
+				<-released
+				inFlight--
+			}
+		}
+
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+			expired = timer.C
+		}
+		for ctx.Err() == nil {
+			record, err := next()
 			if err == io.EOF {
 				break
 			}
@@ -219,7 +441,44 @@ func run() int {
 				break
 			}
 
-			records <- record
+			// the rest is only read to report what was not checked, the
+			// entries in flight are left to finish
+			if pastDeadline(deadline) {
+				if worthChecking(record) {
+					skipped = append(skipped, record)
+				}
+				continue
+			}
+
+			j := job{ctx: ctx, record: record}
+			if budget != nil && budget.limit > 0 && metered > 0 && worthChecking(record) {
+				j, err = reserve(record)
+				if err == errBudgetExhausted {
+					if metered == len(sources) {
+						deferred = append(deferred, record)
+						continue
+					}
+					// the other sources are still looked up, the entry is
+					// deferred by processEntry
+					j.ctx = budget.withoutRequests(ctx)
+				} else if err != nil {
+					// the lookups will run into it again
+					l.Printf("Error reserving requests: %s", err.Error())
+				}
+			}
+
+			// the workers may all be busy until after the deadline
+			select {
+			case records <- j:
+			case <-expired:
+				if j.res != nil {
+					j.res.release()
+					inFlight--
+				}
+				if worthChecking(record) {
+					skipped = append(skipped, record)
+				}
+			}
 		}
 		close(records)
 
@@ -227,28 +486,168 @@ func run() int {
 		close(results)
 	}()
 
-	// Read from the result and apply any further logic
+	var refused []buylistEntry
 	for result := range results {
+		if result.deferred != nil {
+			refused = append(refused, *result.deferred)
+		}
+		fn(result)
+	}
+	return append(refused, deferred...), skipped
+}
+
+// The buylist price of an entry in its condition, the one compared with
+// the prices, zero for the conditions not bought
+func entryValue(entry buylistEntry) Money {
+	price, _ := conditionPrice(entry.Price, entry.Condition)
+	return price
+}
+
+// Whether an entry would be looked up, as processEntry skips the cheap
+// ones and the conditions not bought
+func worthChecking(entry buylistEntry) bool {
+	return entryValue(entry).Float() >= Threshold
+}
+
+// Read the whole buylist, the error is the one that stopped the reading,
+// io.EOF when it went through
+func readEntries(bl BuylistSource) ([]buylistEntry, error) {
+	var entries []buylistEntry
+	for {
+		entry, err := bl.Next()
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Sort the entries from the highest buylist price
+func sortByValue(entries []buylistEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entryValue(entries[i]).Cents > entryValue(entries[j]).Cents
+	})
+}
+
+func (r result) spread() float64 {
+	arb := r.buylistPrice.Sub(r.price)
+	return 100 * float64(arb.Cents) / float64(r.price.Cents)
+}
+
+// Look up the entries of a buylist file, writing the opportunities to out
+// and, if not nil, the entries not found to unmatched
+func arbitrage(ctx context.Context, sources []PriceSource, path string, deadline time.Time, out, unmatched io.Writer) error {
+	l := log.New(os.Stderr, "", 0)
+
+	multiSource := len(sources) > 1
+
+	// the language is shown when non-English cards may be priced
+	withLanguage := Config.NonEnglish == "flag"
+	for _, src := range sources {
+		withLanguage = withLanguage || multilingual(src)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	bl, err := newBuylistSource(Config.BuylistFormat, file)
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(out)
+	defer w.Flush()
+
+	var uw *csv.Writer
+	if unmatched != nil {
+		uw = csv.NewWriter(unmatched)
+		defer uw.Flush()
+		uw.Write(unmatchedHeader)
+	}
+
+	// opportunities are new if they were not there in the previous run
+	notifiers := newNotifiers()
+	previous := map[string]opportunity{}
+	if len(notifiers) > 0 && Config.HistoryFile != "" {
+		// without the previous run every opportunity would look new, the
+		// run itself is still worth doing
+		previous, err = lastRun(Config.HistoryFile)
+		if err != nil {
+			l.Println("Error reading history, no notification sent:", err)
+			notifiers = nil
+		}
+	}
+	var deals []deal
+
+	// every fetched price is kept, as of the start of the run
+	var hist *history
+	if Config.HistoryFile != "" {
+		hist, err = openHistory(Config.HistoryFile)
+		if err != nil {
+			return err
+		}
+	}
+	started := time.Now()
+
+	// a failing output stops the run, the server must not die with it
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var writeErr error
+
+	entries := 0
+
+	// Read from the result and apply any further logic
+	deferred, unchecked := processAll(ctx, sources, bl, deadline, func(result result) {
+		for _, warn := range result.warns {
+			l.Println(warn)
+		}
 		if result.err != nil {
 			l.Println(result.err)
-			continue
+			if uw != nil && result.unmatched != nil {
+				uw.Write(result.unmatched)
+			}
+			return
+		}
+		if hist != nil {
+			err := hist.addResult(started, result)
+			if err != nil {
+				l.Println("Error saving history:", err)
+			}
 		}
 
-		if result.price > 0 && result.price <= Tolerance*result.buylistPrice {
+		if writeErr == nil && result.price.IsPositive() &&
+			float64(result.price.Cents) <= Tolerance*float64(result.buylistPrice.Cents) {
 			if entries == 0 {
 				header := []string{
 					"URL", "Name", "Set", "Foil", "Buylist Price", "CS Price", "Arb", "Spread",
 				}
+				if sources[0].Name() != "cardshark" {
+					header[5] = "Price"
+				}
+				if multiSource {
+					header[5] = "Best Price"
+					header = append(header, "Source", "Runner-up", "Runner-up Price")
+				}
+				if bl.HasConditions() {
+					header = append(header, "Condition")
+				}
+				if withLanguage {
+					header = append(header, "Language")
+				}
 				w.Write(header)
 			}
 			foil := ""
 			if result.isFoil {
 				foil = "X"
 			}
-			buylistPriceStr := fmt.Sprintf("%0.2f", result.buylistPrice)
-			priceStr := fmt.Sprintf("%0.2f", result.price)
-			diff := fmt.Sprintf("%0.2f", result.buylistPrice-result.price)
-			spread := fmt.Sprintf("%0.2f%%", 100*(result.buylistPrice-result.price)/result.price)
+			arb := result.buylistPrice.Sub(result.price)
+			buylistPriceStr := result.buylistPrice.String()
+			priceStr := result.price.String()
+			diff := arb.String()
+			spread := fmt.Sprintf("%0.2f%%", result.spread())
 
 			record := []string{
 				result.url,
@@ -260,16 +659,97 @@ func run() int {
 				diff,
 				spread,
 			}
-			err := w.Write(record)
-			if err != nil {
-				log.Fatalln("Error writing record to csv: ", err)
+			if multiSource {
+				runnerUpPriceStr := ""
+				if result.runnerUp != "" {
+					runnerUpPriceStr = result.runnerUpPrice.String()
+				}
+				record = append(record, result.source, result.runnerUp, runnerUpPriceStr)
 			}
-
+			if bl.HasConditions() {
+				record = append(record, result.condition)
+			}
+			if withLanguage {
+				record = append(record, result.language)
+			}
+			w.Write(record)
 			w.Flush()
+			err := w.Error()
+			if err != nil {
+				writeErr = fmt.Errorf("Error writing record to csv: %s", err.Error())
+				cancel()
+				return
+			}
 			entries++
+
+			_, seen := previous[opportunity{card: result.card}.key()]
+			if !seen && notifiable(result) {
+				deals = append(deals, newDeal(result))
+			}
+		}
+	})
+
+	reportDeferred(deferred)
+	if writeErr == nil {
+		w.Flush()
+		err = reportUnchecked(out, unchecked)
+		if err != nil {
+			writeErr = fmt.Errorf("Error writing record to csv: %s", err.Error())
+		}
+	}
+
+	for _, err := range notifyAll(notifiers, deals) {
+		l.Println(err)
+	}
+
+	if hist != nil {
+		// a run that didn't go through the whole buylist can't tell
+		// which opportunities are new
+		kind := fullRun
+		if len(deferred) > 0 || len(unchecked) > 0 || ctx.Err() != nil || writeErr != nil {
+			kind = partialRun
 		}
+		err = hist.Close(kind)
+		if err != nil {
+			l.Println("Error saving history:", err)
+		}
+	}
+
+	// Keep track of what CS returned for offline validation
+	err = cardCatalogue.save(Config.CatalogueFile)
+	if err != nil {
+		l.Println("Error saving catalogue:", err)
+	}
+
+	return writeErr
+}
+
+func run() int {
+	if len(os.Args) < 2 {
+		log.Fatal(fmt.Errorf("usage: <exe> [command] <csv>"))
+	}
+	cmd, found := commands[os.Args[1]]
+	if found {
+		return cmd(os.Args[2:])
 	}
 
+	fs := flag.NewFlagSet("cardsharker", flag.ExitOnError)
+	maxDuration := fs.Duration("max-duration", 0, "stop checking new entries after this long, as a Go duration")
+	deadlineFlag := fs.String("deadline", "", "stop checking new entries at this time, as 15:04 or RFC3339")
+	fs.Parse(os.Args[1:])
+	if fs.NArg() != 1 {
+		log.Fatal(fmt.Errorf("usage: <exe> [-max-duration <duration>] [-deadline <time>] <csv>"))
+	}
+	deadline, err := runDeadline(*maxDuration, *deadlineFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sources := setup()
+	err = arbitrage(context.Background(), sources, fs.Arg(0), deadline, os.Stdout, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
 	return 0
 }
 
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Buylist prices are in this currency, anything else is converted
+const BaseCurrency = "USD"
+
+// An amount in cents of the given currency
+type Money struct {
+	Cents    int64
+	Currency string
+}
+
+// Currency symbols that may prefix a price
+var currencySymbols = map[string]string{
+	"$": "USD",
+	"€": "EUR",
+	"£": "GBP",
+}
+
+// Values meaning that there is no price
+var noPrice = map[string]bool{
+	"":     true,
+	"-":    true,
+	"--":   true,
+	"N/A":  true,
+	"NA":   true,
+	"NONE": true,
+}
+
+// Parse a price such as "$1,234.56", "1.234,56 €" or "N/A", the currency
+// is used when the string has none; a missing price is zero, not an error,
+// and the amount is parsed as text, so that there are no rounding errors
+func parseMoney(s string, currency string) (Money, error) {
+	str := strings.TrimSpace(s)
+	if noPrice[strings.ToUpper(str)] {
+		return Money{Currency: currency}, nil
+	}
+
+	for symbol, code := range currencySymbols {
+		if strings.HasPrefix(str, symbol) || strings.HasSuffix(str, symbol) {
+			str = strings.TrimSuffix(strings.TrimPrefix(str, symbol), symbol)
+			currency = code
+			break
+		}
+	}
+	for _, code := range currencySymbols {
+		if strings.HasPrefix(str, code) || strings.HasSuffix(str, code) {
+			str = strings.TrimSuffix(strings.TrimPrefix(str, code), code)
+			currency = code
+			break
+		}
+	}
+
+	str = strings.TrimSpace(strings.Replace(str, "\u00a0", " ", -1))
+	negative := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(str, "-")
+
+	// whichever separator comes last is the decimal one, unless it is the
+	// only one and followed by a thousands group, as in "1,234" or "1.234"
+	whole, frac := str, ""
+	last := strings.LastIndexAny(str, ",.")
+	if last >= 0 {
+		before, after := str[:last], str[last+1:]
+		_, grouped := thousands(str)
+		if strings.ContainsAny(before, ",. ") || len(after) != 3 || !grouped {
+			whole, frac = before, after
+		}
+	}
+	whole, ok := thousands(whole)
+	if !ok || whole == "" && frac == "" {
+		return Money{}, fmt.Errorf("invalid price %q", s)
+	}
+
+	var cents int64
+	if whole != "" {
+		value, err := strconv.ParseUint(whole, 10, 63)
+		if err != nil {
+			return Money{}, fmt.Errorf("invalid price %q", s)
+		}
+		cents = int64(value) * 100
+	}
+	if frac != "" {
+		for _, r := range frac {
+			if r < '0' || r > '9' {
+				return Money{}, fmt.Errorf("invalid price %q", s)
+			}
+		}
+		frac += "00"
+		value, _ := strconv.ParseInt(frac[:2], 10, 64)
+		cents += value
+		// round half up on the third digit
+		if frac[2] >= '5' {
+			cents++
+		}
+	}
+
+	if negative {
+		cents = -cents
+	}
+	return Money{Cents: cents, Currency: currency}, nil
+}
+
+// The digits of a whole amount, which may be split in groups of three by
+// a single kind of thousands separator, a comma, a dot or a space
+func thousands(s string) (string, bool) {
+	i := strings.IndexAny(s, ",. ")
+	if i < 0 {
+		return s, true
+	}
+	groups := strings.Split(s, s[i:i+1])
+	for j, group := range groups {
+		if j == 0 && (len(group) == 0 || len(group) > 3 || group[0] == '0') ||
+			j > 0 && len(group) != 3 ||
+			strings.Trim(group, "0123456789") != "" {
+			return "", false
+		}
+	}
+	return strings.Join(groups, ""), true
+}
+
+// Formatted without the currency, as "1234.56"
+func (m Money) String() string {
+	sign := ""
+	cents := m.Cents
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (m Money) Float() float64 {
+	return float64(m.Cents) / 100
+}
+
+func (m Money) IsPositive() bool {
+	return m.Cents > 0
+}
+
+// Difference of two amounts in the same currency
+func (m Money) Sub(o Money) Money {
+	if m.Currency != o.Currency {
+		panic(fmt.Sprintf("subtracting %s from %s", o.Currency, m.Currency))
+	}
+	return Money{Cents: m.Cents - o.Cents, Currency: m.Currency}
+}
+
+// The amount multiplied by a factor, rounded to the cent
+func (m Money) Scale(factor float64) Money {
+	return Money{Cents: int64(math.Round(float64(m.Cents) * factor)), Currency: m.Currency}
+}
+
+// Convert to another currency, using the exchange rates in the config,
+// expressed as the value in USD of one unit of each currency
+func (m Money) Convert(currency string) (Money, error) {
+	if m.Currency == currency {
+		return m, nil
+	}
+	rate := func(code string) (float64, error) {
+		if code == BaseCurrency {
+			return 1, nil
+		}
+		value, found := Config.ExchangeRates[code]
+		if !found || value <= 0 {
+			return 0, fmt.Errorf("Missing exchange rate for %s in %s", code, ConfigFile)
+		}
+		return value, nil
+	}
+	from, err := rate(m.Currency)
+	if err != nil {
+		return Money{}, err
+	}
+	to, err := rate(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{
+		Cents:    int64(math.Round(float64(m.Cents) * from / to)),
+		Currency: currency,
+	}, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		s        string
+		cents    int64
+		currency string
+		valid    bool
+	}{
+		{"1.50", 150, "USD", true},
+		{"$1,234.56", 123456, "USD", true},
+		{"1.234,56 €", 123456, "EUR", true},
+		{"1 234,56", 123456, "USD", true},
+		{"1 234.56", 123456, "USD", true},
+		{"1,234", 123400, "USD", true},
+		{"1.234", 123400, "USD", true},
+		{"1,234,567.8", 123456780, "USD", true},
+		{"12,5", 1250, "USD", true},
+		{"0.125", 13, "USD", true},
+		{"0,500", 50, "USD", true},
+		{"1234.567", 123457, "USD", true},
+		{".99", 99, "USD", true},
+		{"-2.00", -200, "USD", true},
+		{"£3", 300, "GBP", true},
+		{"4.20 EUR", 420, "EUR", true},
+		{"N/A", 0, "USD", true},
+		{"", 0, "USD", true},
+		{"--", 0, "USD", true},
+
+		{"1,2,3", 0, "", false},
+		{"3.1.4", 0, "", false},
+		{"1,23,456", 0, "", false},
+		{"1.234,5.6", 0, "", false},
+		{"1,234 567", 0, "", false},
+		{"12a", 0, "", false},
+		{"1.2x", 0, "", false},
+		{".", 0, "", false},
+		{"$", 0, "", false},
+	}
+	for _, test := range tests {
+		m, err := parseMoney(test.s, "USD")
+		if (err == nil) != test.valid {
+			t.Errorf("parseMoney(%q) error = %v, want valid %t", test.s, err, test.valid)
+			continue
+		}
+		if test.valid && (m.Cents != test.cents || m.Currency != test.currency) {
+			t.Errorf("parseMoney(%q) = %d %s, want %d %s", test.s, m.Cents, m.Currency, test.cents, test.currency)
+		}
+	}
+}
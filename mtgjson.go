@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The fields of a MTGJSON set that are needed to build the tables
+type mtgjsonSet struct {
+	Name  string `json:"name"`
+	Code  string `json:"code"`
+	Cards []struct {
+		Name string `json:"name"`
+	} `json:"cards"`
+}
+
+// CK names of the sets that don't follow the MTGJSON naming
+var ckSetNames = map[string]string{
+	"Limited Edition Alpha":         "Alpha",
+	"Limited Edition Beta":          "Beta",
+	"Unlimited Edition":             "Unlimited",
+	"Revised Edition":               "3rd Edition",
+	"Fourth Edition":                "4th Edition",
+	"Fifth Edition":                 "5th Edition",
+	"Classic Sixth Edition":         "6th Edition",
+	"Seventh Edition":               "7th Edition",
+	"Eighth Edition":                "8th Edition",
+	"Ninth Edition":                 "9th Edition",
+	"Tenth Edition":                 "10th Edition",
+	"Magic 2010":                    "2010 Core Set",
+	"Magic 2011":                    "2011 Core Set",
+	"Magic 2012":                    "2012 Core Set",
+	"Magic 2013":                    "2013 Core Set",
+	"Magic 2014":                    "2014 Core Set",
+	"Magic 2015":                    "2015 Core Set",
+	"Archenemy: Nicol Bolas":        "Archenemy - Nicol Bolas",
+	"Battle Royale Box Set":         "Battle Royale",
+	"Beatdown Box Set":              "Beatdown",
+	"Commander Anthology Volume II": "Commander Anthology Vol. II",
+	"Conspiracy: Take the Crown":    "Conspiracy - Take the Crown",
+	"Deckmasters":                   "Deckmaster",
+	"Portal Second Age":             "Portal II",
+	"Portal Three Kingdoms":         "Portal 3K",
+	"Ravnica: City of Guilds":       "Ravnica",
+	"Shadows over Innistrad":        "Shadows Over Innistrad",
+	"Time Spiral Timeshifted":       "Timeshifted",
+}
+
+var (
+	arenaSetRe = regexp.MustCompile(`^Arena League (\d{4})$`)
+	fnmSetRe   = regexp.MustCompile(`^Friday Night Magic (\d{4})$`)
+)
+
+// Tables generated from MTGJSON, in the same format as the tables.go ones
+type mtgjsonTables struct {
+	setMap    map[string]string
+	arenaYear map[string]int
+	fnmYears  map[string]string
+}
+
+// Decode the sets of an AllPrintings file one at a time, it's too large
+// to be loaded at once; both the v4 (sets at the top level) and the v5
+// (sets in "data") layouts are supported
+func loadMTGJSON(path string, fn func(set *mtgjsonSet)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	_, err = dec.Token()
+	if err != nil {
+		return fmt.Errorf("Error decoding %s: %s", path, err.Error())
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("Error decoding %s: %s", path, err.Error())
+		}
+		switch key {
+		case "meta":
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		case "data":
+			_, err = dec.Token()
+			for err == nil && dec.More() {
+				_, err = dec.Token()
+				if err != nil {
+					break
+				}
+				var set mtgjsonSet
+				err = dec.Decode(&set)
+				if err == nil {
+					fn(&set)
+				}
+			}
+			if err == nil {
+				_, err = dec.Token()
+			}
+		default:
+			var set mtgjsonSet
+			err = dec.Decode(&set)
+			if err == nil {
+				fn(&set)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Error decoding %s: %s", path, err.Error())
+		}
+	}
+	return nil
+}
+
+func generateTables(path string) (*mtgjsonTables, error) {
+	tables := &mtgjsonTables{
+		setMap:    map[string]string{},
+		arenaYear: map[string]int{},
+		fnmYears:  map[string]string{},
+	}
+
+	err := loadMTGJSON(path, func(set *mtgjsonSet) {
+		// CK and CS names, CS uses the same conventions as for Scryfall
+		ckSet, found := ckSetNames[set.Name]
+		if !found {
+			ckSet = set.Name
+			if strings.HasPrefix(ckSet, "Duel Decks") {
+				ckSet = strings.Replace(ckSet, " vs. ", " Vs. ", 1)
+			}
+		}
+		csSet := canonicalCSSet(set.Name)
+
+		// sets already converted in code don't need an entry
+		_, mapped := setMap[ckSet]
+		if ckSet != csSet && (mapped || convertSet(ckSet) != csSet) {
+			tables.setMap[ckSet] = csSet
+		}
+
+		// promos are tagged with the year they were released, in case of
+		// reprints the first one is kept
+		match := arenaSetRe.FindStringSubmatch(set.Name)
+		if match != nil {
+			year, _ := strconv.Atoi(match[1])
+			for _, card := range set.Cards {
+				old, found := tables.arenaYear[card.Name]
+				if !found || year < old {
+					tables.arenaYear[card.Name] = year
+				}
+			}
+		}
+		match = fnmSetRe.FindStringSubmatch(set.Name)
+		if match != nil {
+			tag := fmt.Sprintf("(FNM %s)", match[1])
+			for _, card := range set.Cards {
+				old, found := tables.fnmYears[card.Name]
+				if !found || tag < old {
+					tables.fnmYears[card.Name] = tag
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+func sortedKeys(table map[string]string) []string {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Print the generated tables as Go code, ready to replace the tables.go ones
+func mtgjsonTablesCmd(args []string) int {
+	if len(args) < 1 {
+		log.Fatal(fmt.Errorf("usage: <exe> mtgjson <AllPrintings.json>"))
+	}
+
+	tables, err := generateTables(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("package main\n\n// Code generated from MTGJSON AllPrintings, do not edit.\n\n")
+	buf.WriteString("var setMap = map[string]string{\n")
+	for _, key := range sortedKeys(tables.setMap) {
+		fmt.Fprintf(&buf, "%q: %q,\n", key, tables.setMap[key])
+	}
+	buf.WriteString("}\n\nvar arenaYears = map[string]int{\n")
+	years := map[string]string{}
+	for key, year := range tables.arenaYear {
+		years[key] = strconv.Itoa(year)
+	}
+	for _, key := range sortedKeys(years) {
+		fmt.Fprintf(&buf, "%q: %s,\n", key, years[key])
+	}
+	buf.WriteString("}\n\nvar fnmYears = map[string]string{\n")
+	for _, key := range sortedKeys(tables.fnmYears) {
+		fmt.Fprintf(&buf, "%q: %q,\n", key, tables.fnmYears[key])
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Stdout.Write(src)
+	return 0
+}
+
+// Show how the generated tables differ from the tables.go ones; set names
+// are compared through convertSet, so that the sets handled in code are
+// not reported
+func mtgjsonDiff(args []string) int {
+	if len(args) < 1 {
+		log.Fatal(fmt.Errorf("usage: <exe> mtgjson-diff <AllPrintings.json>"))
+	}
+
+	tables, err := generateTables(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	defer w.Flush()
+	w.Write([]string{"Table", "Key", "Current", "Generated"})
+
+	for _, ckSet := range sortedKeys(tables.setMap) {
+		current := convertSet(ckSet)
+		if current != tables.setMap[ckSet] {
+			w.Write([]string{"setMap", ckSet, current, tables.setMap[ckSet]})
+		}
+	}
+	for _, ckSet := range sortedKeys(setMap) {
+		_, found := tables.setMap[ckSet]
+		if !found {
+			w.Write([]string{"setMap", ckSet, setMap[ckSet], ""})
+		}
+	}
+
+	current := map[string]string{}
+	generated := map[string]string{}
+	for key, year := range arenaYears {
+		current[key] = strconv.Itoa(year)
+	}
+	for key, year := range tables.arenaYear {
+		generated[key] = strconv.Itoa(year)
+	}
+	diffTables(w, "arenaYears", current, generated)
+	diffTables(w, "fnmYears", fnmYears, tables.fnmYears)
+
+	return 0
+}
+
+func diffTables(w *csv.Writer, name string, current, generated map[string]string) {
+	keys := map[string]string{}
+	for key := range current {
+		keys[key] = ""
+	}
+	for key := range generated {
+		keys[key] = ""
+	}
+	for _, key := range sortedKeys(keys) {
+		if current[key] != generated[key] {
+			w.Write([]string{name, key, current[key], generated[key]})
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+)
+
+// Characters that are spelled in more than one way across vendors
+var foldReplacer = strings.NewReplacer(
+	// ligatures
+	"Æ", "Ae", "æ", "ae", "Œ", "Oe", "œ", "oe",
+	// quotes
+	"‘", "'", "’", "'", "‚", "'", "‛", "'", "`", "'", "´", "'",
+	"“", "\"", "”", "\"", "„", "\"",
+	// dashes
+	"‐", "-", "‑", "-", "‒", "-", "–", "-", "—", "-", "―", "-",
+	// diacritics
+	"à", "a", "á", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"À", "A", "Á", "A", "Â", "A", "Ä", "A", "Ã", "A", "Å", "A",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"È", "E", "É", "E", "Ê", "E", "Ë", "E",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"Ì", "I", "Í", "I", "Î", "I", "Ï", "I",
+	"ò", "o", "ó", "o", "ô", "o", "ö", "o", "õ", "o",
+	"Ò", "O", "Ó", "O", "Ô", "O", "Ö", "O", "Õ", "O",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"Ù", "U", "Ú", "U", "Û", "U", "Ü", "U",
+	"ñ", "n", "Ñ", "N", "ç", "c", "Ç", "C",
+)
+
+// Canonical form of a card name, only meant for comparisons
+func foldName(cardName string) string {
+	return strings.ToLower(strings.TrimSpace(foldReplacer.Replace(cardName)))
+}
+
+// Whether two names refer to the same card once normalized
+func sameName(a, b string) bool {
+	return foldName(a) == foldName(b)
+}
+
+// Rebuild a table keyed by the canonical form of its names
+func foldKeys(table map[string]string) map[string]string {
+	folded := make(map[string]string, len(table))
+	for key, value := range table {
+		folded[foldName(key)] = value
+	}
+	return folded
+}
+
+// The way a given card is spelled by a target, if set is empty the rule
+// applies to any edition
+type renderRule struct {
+	name   string
+	set    string
+	render string
+}
+
+// Replace from with to in names containing match, if sets is empty the
+// rule applies to any edition, otherwise the names of the other editions
+// are kept as they are
+type substitution struct {
+	match string
+	sets  []string
+	from  string
+	to    string
+}
+
+// The spelling conventions of a target
+type nameStyle struct {
+	rules         map[string][]renderRule
+	substitutions []substitution
+}
+
+func newNameStyle(rules []renderRule, substitutions []substitution) *nameStyle {
+	style := &nameStyle{
+		rules:         map[string][]renderRule{},
+		substitutions: substitutions,
+	}
+	for _, rule := range rules {
+		key := foldName(rule.name)
+		style.rules[key] = append(style.rules[key], rule)
+	}
+	return style
+}
+
+// Spell the card name as the target does, a rule for the specific set
+// wins over a generic one, and substitutions are used only if no rule
+// matches; returns false if neither claims the name
+func (style *nameStyle) render(cardName, cardSet string) (string, bool) {
+	var fallback *renderRule
+	for i, rule := range style.rules[foldName(cardName)] {
+		if rule.set == cardSet {
+			return rule.render, true
+		}
+		if rule.set == "" {
+			fallback = &style.rules[foldName(cardName)][i]
+		}
+	}
+	if fallback != nil {
+		return fallback.render, true
+	}
+
+	for _, sub := range style.substitutions {
+		if !strings.Contains(cardName, sub.match) {
+			continue
+		}
+		if len(sub.sets) > 0 && !containsString(sub.sets, cardSet) {
+			return cardName, true
+		}
+		return strings.Replace(cardName, sub.from, sub.to, -1), true
+	}
+
+	return cardName, false
+}
+
+// All the names that the target may have rendered as the given one
+func (style *nameStyle) unrender(cardName, cardSet string) []string {
+	var names []string
+	for _, rules := range style.rules {
+		for _, rule := range rules {
+			if sameName(rule.render, cardName) && (rule.set == "" || rule.set == cardSet) {
+				names = append(names, rule.name)
+			}
+		}
+	}
+	for _, sub := range style.substitutions {
+		if len(sub.sets) > 0 && !containsString(sub.sets, cardSet) {
+			continue
+		}
+		// only the match is turned back when it changes, the rest of the
+		// name may well hold to too
+		rendered := strings.Replace(sub.match, sub.from, sub.to, -1)
+		if rendered != sub.match {
+			if strings.Contains(cardName, rendered) {
+				names = append(names, strings.Replace(cardName, rendered, sub.match, -1))
+			}
+			continue
+		}
+		if strings.Contains(cardName, sub.to) {
+			name := strings.Replace(cardName, sub.to, sub.from, -1)
+			if strings.Contains(name, sub.match) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func containsString(list []string, s string) bool {
+	for _, entry := range list {
+		if entry == s {
+			return true
+		}
+	}
+	return false
+}
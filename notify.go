@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type notifyConfig struct {
+	// minimum difference between buylist price and price, in USD
+	MinProfit float64 `json:"min_profit"`
+
+	// the deals are posted as JSON to this URL
+	WebhookURL string `json:"webhook_url"`
+
+	SMTP *smtpConfig `json:"smtp"`
+}
+
+type smtpConfig struct {
+	// host:port of the server
+	Addr     string   `json:"addr"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	User     string   `json:"user"`
+	Password string   `json:"password"`
+}
+
+// An opportunity as sent to the notifiers
+type deal struct {
+	Name         string  `json:"name"`
+	Set          string  `json:"set"`
+	Foil         bool    `json:"foil"`
+	Condition    string  `json:"condition,omitempty"`
+	Language     string  `json:"language,omitempty"`
+	URL          string  `json:"url"`
+	Source       string  `json:"source"`
+	BuylistPrice float64 `json:"buylist_price"`
+	Price        float64 `json:"price"`
+	Profit       float64 `json:"profit"`
+	Spread       float64 `json:"spread"`
+	Currency     string  `json:"currency"`
+}
+
+func newDeal(r result) deal {
+	return deal{
+		Name:         r.cardName,
+		Set:          r.cardSet,
+		Foil:         r.isFoil,
+		Condition:    r.condition,
+		Language:     r.language,
+		URL:          r.url,
+		Source:       r.source,
+		BuylistPrice: r.buylistPrice.Float(),
+		Price:        r.price.Float(),
+		Profit:       r.buylistPrice.Sub(r.price).Float(),
+		Spread:       r.spread(),
+		Currency:     r.price.Currency,
+	}
+}
+
+// Notifier sends the new opportunities found by a run somewhere
+type Notifier interface {
+	Notify(deals []deal) error
+}
+
+// The notifiers set in the config, none if there is no "notify" section
+func newNotifiers() []Notifier {
+	var notifiers []Notifier
+	if Config.Notify == nil {
+		return nil
+	}
+	if Config.Notify.WebhookURL != "" {
+		notifiers = append(notifiers, &webhookNotifier{
+			url:    Config.Notify.WebhookURL,
+			client: &http.Client{Timeout: 30 * time.Second},
+		})
+	}
+	if Config.Notify.SMTP != nil {
+		notifiers = append(notifiers, &smtpNotifier{Config.Notify.SMTP})
+	}
+	return notifiers
+}
+
+// Whether a result is worth a notification
+func notifiable(r result) bool {
+	if Config.Notify == nil {
+		return false
+	}
+	profit, err := r.buylistPrice.Sub(r.price).Convert(BaseCurrency)
+	return err == nil && profit.Float() >= Config.Notify.MinProfit
+}
+
+// Send the deals to every notifier, returning the errors of the ones
+// that failed
+func notifyAll(notifiers []Notifier, deals []deal) []error {
+	if len(deals) == 0 {
+		return nil
+	}
+	var errs []error
+	for _, n := range notifiers {
+		err := n.Notify(deals)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// POST {"deals": [...]} to a URL
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (wh *webhookNotifier) Notify(deals []deal) error {
+	body, err := json.Marshal(struct {
+		Deals []deal `json:"deals"`
+	}{deals})
+	if err != nil {
+		return err
+	}
+	resp, err := wh.client.Post(wh.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Error posting to webhook - %q", err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Error posting to webhook - %s %q", resp.Status, string(data))
+	}
+	return nil
+}
+
+// A plain text digest of the deals, mailed through an SMTP server
+type smtpNotifier struct {
+	cfg *smtpConfig
+}
+
+func (sn *smtpNotifier) Notify(deals []deal) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", sn.cfg.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(sn.cfg.To, ", "))
+	fmt.Fprintf(&body, "Subject: %d new buylist opportunities\r\n", len(deals))
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	for _, d := range deals {
+		foil := ""
+		if d.Foil {
+			foil = " (foil)"
+		}
+		fmt.Fprintf(&body, "%s - %s%s: buy at %0.2f, sell at %0.2f %s, %0.2f%%\r\n  %s\r\n",
+			d.Name, d.Set, foil, d.Price, d.BuylistPrice, d.Currency, d.Spread, d.URL)
+	}
+
+	var auth smtp.Auth
+	if sn.cfg.User != "" {
+		host := sn.cfg.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", sn.cfg.User, sn.cfg.Password, host)
+	}
+	err := smtp.SendMail(sn.cfg.Addr, auth, sn.cfg.From, sn.cfg.To, body.Bytes())
+	if err != nil {
+		return fmt.Errorf("Error sending email - %q", err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testDeals = []deal{
+	{
+		Name:         "Bribery (DCI Judge Foil)",
+		Set:          "Promotional DCI Judge",
+		Foil:         true,
+		URL:          "http://cs/bribery",
+		Source:       "cardshark",
+		BuylistPrice: 50,
+		Price:        20,
+		Profit:       30,
+		Spread:       150,
+		Currency:     "USD",
+	},
+	{
+		Name:         "Æther Vial",
+		Set:          "Darksteel",
+		Condition:    "EX",
+		URL:          "http://cs/vial",
+		Source:       "cardshark",
+		BuylistPrice: 16,
+		Price:        12,
+		Profit:       4,
+		Spread:       33.33,
+		Currency:     "USD",
+	},
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got struct {
+		Deals []deal `json:"deals"`
+	}
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		err := json.NewDecoder(r.Body).Decode(&got)
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	wh := &webhookNotifier{url: srv.URL, client: srv.Client()}
+	err := wh.Notify(testDeals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	if !reflect.DeepEqual(got.Deals, testDeals) {
+		t.Errorf("posted %+v, want %+v", got.Deals, testDeals)
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	wh := &webhookNotifier{url: srv.URL, client: srv.Client()}
+	err := wh.Notify(testDeals)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Notify() = %v, want a 500 error", err)
+	}
+}
+
+// A server speaking just enough SMTP to take one mail, sent on the channel
+func smtpStub(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mails := make(chan string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) {
+			conn.Write([]byte(line + "\r\n"))
+		}
+		reply("220 localhost")
+		var mail []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					mail = append(mail, line)
+				}
+				mails <- strings.Join(mail, "")
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String(), mails
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, mails := smtpStub(t)
+
+	sn := &smtpNotifier{&smtpConfig{
+		Addr: addr,
+		From: "cardsharker@example.com",
+		To:   []string{"me@example.com", "you@example.com"},
+	}}
+	err := sn.Notify(testDeals)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mail := <-mails
+	for _, want := range []string{
+		"From: cardsharker@example.com\r\n",
+		"To: me@example.com, you@example.com\r\n",
+		"Subject: 2 new buylist opportunities\r\n",
+		"Bribery (DCI Judge Foil) - Promotional DCI Judge (foil): buy at 20.00, sell at 50.00 USD, 150.00%\r\n",
+		"Æther Vial - Darksteel: buy at 12.00, sell at 16.00 USD, 33.33%\r\n",
+		"http://cs/vial",
+	} {
+		if !strings.Contains(mail, want) {
+			t.Errorf("mail is missing %q:\n%s", want, mail)
+		}
+	}
+}
+
+type fakeNotifier struct {
+	sent [][]deal
+	err  error
+}
+
+func (fn *fakeNotifier) Notify(deals []deal) error {
+	fn.sent = append(fn.sent, deals)
+	return fn.err
+}
+
+func TestNotifyAll(t *testing.T) {
+	ok := &fakeNotifier{}
+	failing := &fakeNotifier{err: errors.New("down")}
+
+	errs := notifyAll([]Notifier{ok, failing}, nil)
+	if len(errs) != 0 || len(ok.sent) != 0 || len(failing.sent) != 0 {
+		t.Errorf("notifyAll with no deals sent %v %v, errors %v", ok.sent, failing.sent, errs)
+	}
+
+	errs = notifyAll([]Notifier{ok, failing}, testDeals)
+	if len(errs) != 1 || errs[0] != failing.err {
+		t.Errorf("notifyAll errors = %v, want [down]", errs)
+	}
+	if len(ok.sent) != 1 || len(failing.sent) != 1 {
+		t.Errorf("notifyAll sent %d and %d times, want once each", len(ok.sent), len(failing.sent))
+	}
+}
+
+func TestNotifyConfig(t *testing.T) {
+	var cfg config
+	err := json.Unmarshal([]byte(`{"notify": {"min_profit": 5, "webhook_url": "http://localhost/hook",
+		"smtp": {"addr": "localhost:25", "from": "a@b", "to": ["c@d"]}}}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Notify.MinProfit != 5 || cfg.Notify.WebhookURL != "http://localhost/hook" ||
+		cfg.Notify.SMTP.Addr != "localhost:25" || len(cfg.Notify.SMTP.To) != 1 {
+		t.Errorf("unexpected notify config %+v %+v", cfg.Notify, cfg.Notify.SMTP)
+	}
+}
@@ -5,9 +5,17 @@ import (
 	"strings"
 )
 
-// if cardName or cardSet are empty it's safe to skip
-// otherwise error field will contain more info
-func processRecord(cardName, cardSet string) (string, string, error) {
+// CS spelling conventions
+var csStyle = newNameStyle(csNameRules, csSubstitutions)
+
+// tables looked up regardless of spelling differences
+var (
+	aetherIndex     = foldKeys(aetherMess)
+	anyVariantIndex = foldKeys(anyVariant)
+)
+
+// Cards and sets that are not worth querying
+func skipCard(cardName, cardSet string) bool {
 	// Skip basic lands, and strange cards
 	if strings.HasPrefix(cardName, "Plains") ||
 		strings.HasPrefix(cardName, "Island") ||
@@ -15,33 +23,19 @@ func processRecord(cardName, cardSet string) (string, string, error) {
 		strings.HasPrefix(cardName, "Mountain") ||
 		strings.HasPrefix(cardName, "Forest") ||
 		strings.HasPrefix(cardName, "Wastes") {
-		return "", "", nil
+		return true
 	}
 	if strings.Contains(cardName, "Token") ||
 		strings.Contains(cardName, "Emblem") ||
 		strings.Contains(cardName, "Oversized") ||
 		strings.Contains(cardName, "Promo Plane") {
-		return "", "", nil
-	}
-
-	// Drop qualifiers from the card name
-	cardName = strings.Replace(cardName, " (Foil)", "", 1)
-	cardName = strings.Replace(cardName, " (Foil - Planeswalker Deck)", "", 1)
-	cardName = strings.Replace(cardName, " (Planeswalker Deck)", "", 1)
-	cardName = strings.Replace(cardName, " (Planeswalker Deck Foil)", "", 1)
-	cardName = strings.Replace(cardName, " (Spellslinger Starter Kit)", "", 1)
-	cardName = strings.Replace(cardName, " (Welcome Deck)", "", 1)
-	cardName = strings.Replace(cardName, " (Brawl Deck Card)", "", 1)
-	if cardSet == "Throne of Eldraine Variants" {
-		cardName = strings.Replace(cardName, " (Showcase)", "", 1)
-		cardName = strings.Replace(cardName, " (Extended Art)", "", 1)
-		cardName = strings.Replace(cardName, " (Borderless)", "", 1)
+		return true
 	}
 
 	// Skip sets that make too much noise
 	if strings.HasPrefix(cardSet, "Masterpiece Series") ||
 		strings.HasPrefix(cardSet, "Un") {
-		return "", "", nil
+		return true
 	}
 	switch cardSet {
 	case "Alpha", "Beta", "Collectors Ed", // these are present, but empty
@@ -52,26 +46,16 @@ func processRecord(cardName, cardSet string) (string, string, error) {
 		"Mystery Booster",
 		"Promo Pack",
 		"Ultimate Box Topper",
-		"World Championships", // CS does not distinguish deck types anyway
-		"War of the Spark JPN Planeswalkers":
-		return "", "", nil
+		"World Championships": // CS does not distinguish deck types anyway
+		return true
 	}
 
-	// Handle split cards, some editions treat the separator differently
-	if strings.Contains(cardName, "//") {
-		switch cardSet {
-		case "Guilds of Ravnica", "Ravnica Allegiance", "Hour of Devastation",
-			"Ultimate Masters", "Commander 2019", "Commander",
-			"Duel Decks: Ajani Vs. Nicol Bolas", "Duel Decks: Izzet Vs. Golgari":
-			s := strings.Split(cardName, " // ")
-			cardName = s[0]
-		case "Planar Chaos", "Timeshifted":
-			cardName = strings.Replace(cardName, "// ", " ", 1)
-		default:
-			cardName = strings.Replace(cardName, "// ", "", 1)
-		}
-	}
+	return false
+}
 
+// Convert a CK set name to CS, the special cases depending on the card are
+// left to processRecord
+func convertSet(cardSet string) string {
 	// Replace unsupported characters
 	if strings.Contains(cardSet, "Duel Decks") ||
 		strings.Contains(cardSet, "From the Vault") ||
@@ -95,11 +79,54 @@ func processRecord(cardName, cardSet string) (string, string, error) {
 		cardSet = strings.Replace(cardSet, "Vs.", "vs.", 1)
 	}
 
+	// the language is kept apart, see ckLanguage
+	cardSet = strings.TrimSuffix(cardSet, " JPN Planeswalkers")
+
 	// Convert edition names if needed
 	entry, found := setMap[cardSet]
 	if found {
 		cardSet = entry
 	}
+	return cardSet
+}
+
+// if cardName or cardSet are empty it's safe to skip
+// otherwise error field will contain more info
+func processRecord(cardName, cardSet string) (string, string, error) {
+	if skipCard(cardName, cardSet) {
+		return "", "", nil
+	}
+
+	// Drop qualifiers from the card name
+	cardName = strings.Replace(cardName, " (Foil)", "", 1)
+	cardName = strings.Replace(cardName, " (Foil - Planeswalker Deck)", "", 1)
+	cardName = strings.Replace(cardName, " (Planeswalker Deck)", "", 1)
+	cardName = strings.Replace(cardName, " (Planeswalker Deck Foil)", "", 1)
+	cardName = strings.Replace(cardName, " (Spellslinger Starter Kit)", "", 1)
+	cardName = strings.Replace(cardName, " (Welcome Deck)", "", 1)
+	cardName = strings.Replace(cardName, " (Brawl Deck Card)", "", 1)
+	if cardSet == "Throne of Eldraine Variants" {
+		cardName = strings.Replace(cardName, " (Showcase)", "", 1)
+		cardName = strings.Replace(cardName, " (Extended Art)", "", 1)
+		cardName = strings.Replace(cardName, " (Borderless)", "", 1)
+	}
+
+	// Handle split cards, some editions treat the separator differently
+	if strings.Contains(cardName, "//") {
+		switch cardSet {
+		case "Guilds of Ravnica", "Ravnica Allegiance", "Hour of Devastation",
+			"Ultimate Masters", "Commander 2019", "Commander",
+			"Duel Decks: Ajani Vs. Nicol Bolas", "Duel Decks: Izzet Vs. Golgari":
+			s := strings.Split(cardName, " // ")
+			cardName = s[0]
+		case "Planar Chaos", "Timeshifted":
+			cardName = strings.Replace(cardName, "// ", " ", 1)
+		default:
+			cardName = strings.Replace(cardName, "// ", "", 1)
+		}
+	}
+
+	cardSet = convertSet(cardSet)
 
 	// Convert edition names for difficult cases
 	switch cardSet {
@@ -326,57 +353,17 @@ func processRecord(cardName, cardSet string) (string, string, error) {
 	}
 
 	// OK card set has been found, onto card name typos and peculiarities
+	return csCardName(cardName, cardSet), cardSet, nil
+}
 
-	switch {
-	// These cards only need replacement for some reprints (but not all)
-	case cardName == "Altar of Dementia" && cardSet == "Tempest":
-		cardName = "Altar Of Dementia"
-	case cardName == "Furnace of Rath" && cardSet == "Tempest":
-		cardName = "Furnace Of Rath"
-	case cardName == "Commune with Nature" && cardSet == "Champions of Kamigawa":
-		cardName = "Commune With Nature"
-	case cardName == "Higure, the Still Wind" && cardSet == "Betrayers of Kamigawa":
-		cardName = "Higure, The Still Wind"
-	case cardName == "Flame-Kin Zealot" && cardSet == "Ravnica City of Guilds":
-		cardName = "Flame kin Zealot"
-
-	// CS hates magemarks
-	case strings.Contains(cardName, "Magemark"):
-		cardName = strings.Replace(cardName, "'", "’", 1)
-
-	// CK tyops
-	case strings.Contains(strings.ToLower(cardName), "okiba-gang"):
-		cardName = "Okiba-Gang Shinobi"
-		if cardSet == "Betrayers of Kamigawa" {
-			cardName = "Okiba Gang Shinobi"
-		}
-	case cardName == "Will-O'-The-Wisp" || cardName == "Will-o'-the-Wisp":
-		if cardSet == "Ninth Edition" {
-			cardName = "Will o' the Wisp"
-		} else if cardSet == "Masters 25" {
-			cardName = "Will-o'-the-Wisp"
-		} else {
-			cardName = "Will O' The Wisp"
-		}
-
-	// Custom replacements
-	case strings.Contains(cardName, "Lim-Dul"): // I wonder why CS hates limdul
-		if cardName == "Lim-Dul the Necromancer" || cardName == "Lim-Dul's High Guard" {
-			cardName = strings.Replace(cardName, "Lim-Dul", "Lim Dul", 1)
-		} else if cardName == "Lim-Dul's Vault" && cardSet == "Commander 2013 Edition" {
-			cardName = "Lim-Dûl's Vault"
-		} else {
-			cardName = strings.Replace(cardName, "Lim-Dul", "Lim Dûl", 1)
-		}
-	case strings.Contains(cardName, "Sakura-Tribe"): // I wonder why CS hates steve
-		switch cardSet {
-		case "Promotional Friday Night Magic":
-			cardName = "Sakura - Tribe Elder (FNM 2009)"
-		case "Archenemy", "Champions of Kamigawa", "World Championship Decks",
-			"Promotional Jr Super Series", "Betrayers of Kamigawa":
-			cardName = strings.Replace(cardName, "-", " ", -1)
-		}
+// Card name typos and peculiarities of CS, once the CS set is known
+func csCardName(cardName, cardSet string) string {
+	rendered, found := csStyle.render(cardName, cardSet)
+	if found {
+		return rendered
+	}
 
+	switch {
 	// Guildgates
 	case strings.Contains(cardName, "Guildgate") &&
 		(cardSet == "Ravnica Allegiance" || cardSet == "Guilds of Ravnica"):
@@ -395,24 +382,22 @@ func processRecord(cardName, cardSet string) (string, string, error) {
 	// Urza's lands \o/
 	case strings.HasPrefix(cardName, "Urza's") &&
 		(cardSet == "Antiquities" || cardSet == "Chronicles"):
-		entry, found = urzaLands[cardName][cardSet]
+		entry, found := urzaLands[cardName][cardSet]
 		if found {
 			cardName = entry
 		}
 
 	// Not all Aethers are created equal..
-	case strings.Contains(strings.ToLower(cardName), "aether") &&
-		cardSet != "Commander 2018" &&
-		cardSet != "Explorers of Ixalan" &&
-		cardSet != "Iconic Masters":
-		entry, found = aetherMess[cardName]
+	case strings.Contains(foldName(cardName), "aether") &&
+		!containsString(aetherSets, cardSet):
+		entry, found := aetherIndex[foldName(cardName)]
 		if found {
 			cardName = entry
 		}
 
 	// Last pass for the hard cases
 	default:
-		entry, found = anyVariant[cardName]
+		entry, found := anyVariantIndex[foldName(cardName)]
 		if found {
 			if len(entry) > 0 {
 				cardName = entry
@@ -428,5 +413,5 @@ func processRecord(cardName, cardSet string) (string, string, error) {
 		}
 	}
 
-	return cardName, cardSet, nil
+	return cardName
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// How the price of a card is chosen among the finishes offered
+const (
+	// the price of the same finish as the card
+	PolicyMatching = "matching"
+	// as above, using the other finish when there is no price
+	PolicyPreferMatching = "prefer-matching"
+	PolicyFoil           = "foil"
+	PolicyNonfoil        = "nonfoil"
+	// the lowest or highest among the finishes with a price
+	PolicyMin = "min"
+	PolicyMax = "max"
+)
+
+var pricePolicies = []string{
+	PolicyMatching, PolicyPreferMatching, PolicyFoil, PolicyNonfoil, PolicyMin, PolicyMax,
+}
+
+// Set categories with their own policy, anything else is "default"
+const (
+	CategoryDefault    = "default"
+	CategoryPromo      = "promo"
+	CategoryPrerelease = "prerelease"
+)
+
+// Policies used when not overridden by "price_policies" in the config,
+// promos can't be trusted to be tagged with the right finish, so the
+// lowest price is picked
+var defaultPolicies = map[string]string{
+	CategoryDefault:    PolicyMatching,
+	CategoryPromo:      PolicyMin,
+	CategoryPrerelease: PolicyMin,
+}
+
+func setCategory(cardSet string) string {
+	if strings.HasPrefix(cardSet, "Promotional") {
+		return CategoryPromo
+	}
+	if cardSet == "Prerelease Stamped" {
+		return CategoryPrerelease
+	}
+	return CategoryDefault
+}
+
+// The policy for the set, the config overrides the defaults
+func pricePolicy(cardSet string) string {
+	category := setCategory(cardSet)
+	policy, found := Config.PricePolicies[category]
+	if !found {
+		policy = defaultPolicies[category]
+	}
+	return policy
+}
+
+// Reject unknown categories and policies before any lookup is made
+func validatePolicies() error {
+	for category, policy := range Config.PricePolicies {
+		_, found := defaultPolicies[category]
+		if !found {
+			categories := make([]string, 0, len(defaultPolicies))
+			for name := range defaultPolicies {
+				categories = append(categories, name)
+			}
+			sort.Strings(categories)
+			return fmt.Errorf("Unknown price policy category %q, available: %s",
+				category, strings.Join(categories, ", "))
+		}
+		if !containsString(pricePolicies, policy) {
+			return fmt.Errorf("Unknown price policy %q for %q, available: %s",
+				policy, category, strings.Join(pricePolicies, ", "))
+		}
+	}
+	return nil
+}
+
+// Whether the policy may pick the price of the given finish, so that the
+// problems with the price are worth reporting
+func policyFinish(policy string, isFoil, offerFoil bool) bool {
+	switch policy {
+	case PolicyFoil:
+		return offerFoil
+	case PolicyNonfoil:
+		return !offerFoil
+	case PolicyMin, PolicyMax, PolicyPreferMatching:
+		return true
+	}
+	return offerFoil == isFoil
+}
+
+// Pick the offer according to the policy, the result has no price when
+// the chosen finish is not offered
+func applyPolicy(policy string, offers []offer, isFoil bool) offer {
+	market, _ := findOffer(offers, false)
+	foil, _ := findOffer(offers, true)
+
+	switch policy {
+	case PolicyFoil:
+		return foil
+	case PolicyNonfoil:
+		return market
+	case PolicyMin, PolicyMax:
+		if !market.Price.IsPositive() {
+			return foil
+		}
+		if !foil.Price.IsPositive() {
+			return market
+		}
+		lower := foil.Price.Cents < market.Price.Cents
+		if lower == (policy == PolicyMin) {
+			return foil
+		}
+		return market
+	case PolicyPreferMatching:
+		best, other := market, foil
+		if isFoil {
+			best, other = foil, market
+		}
+		if !best.Price.IsPositive() {
+			return other
+		}
+		return best
+	}
+
+	if isFoil {
+		return foil
+	}
+	return market
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"testing"
+)
+
+func usd(cents int64) Money {
+	return Money{Cents: cents, Currency: "USD"}
+}
+
+// A nonfoil and a foil offer, a zero price means the finish is missing
+func finishOffers(market, foil int64) []offer {
+	var offers []offer
+	if market > 0 {
+		offers = append(offers, offer{Source: "test", Price: usd(market)})
+	}
+	if foil > 0 {
+		offers = append(offers, offer{Source: "test", Price: usd(foil), Foil: true})
+	}
+	return offers
+}
+
+func TestSetCategory(t *testing.T) {
+	tests := []struct {
+		set      string
+		category string
+	}{
+		{"Promotional", CategoryPromo},
+		{"Promotional DCI Judge", CategoryPromo},
+		{"Prerelease Stamped", CategoryPrerelease},
+		{"Revised Edition", CategoryDefault},
+		{"Prerelease Stamped Promos", CategoryDefault},
+	}
+	for _, test := range tests {
+		category := setCategory(test.set)
+		if category != test.category {
+			t.Errorf("setCategory(%q) = %q, want %q", test.set, category, test.category)
+		}
+	}
+}
+
+func TestApplyPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		market int64
+		foil   int64
+		isFoil bool
+		price  int64
+		pick   bool // the foil offer is picked
+	}{
+		{PolicyMatching, 100, 300, false, 100, false},
+		{PolicyMatching, 100, 300, true, 300, true},
+		{PolicyMatching, 100, 0, true, 0, false},
+		{PolicyPreferMatching, 100, 300, true, 300, true},
+		{PolicyPreferMatching, 100, 0, true, 100, false},
+		{PolicyPreferMatching, 0, 300, false, 300, true},
+		{PolicyFoil, 100, 300, false, 300, true},
+		{PolicyFoil, 100, 0, true, 0, false},
+		{PolicyNonfoil, 100, 300, true, 100, false},
+		{PolicyNonfoil, 0, 300, false, 0, false},
+		{PolicyMin, 100, 300, true, 100, false},
+		{PolicyMin, 300, 100, false, 100, true},
+		{PolicyMin, 0, 300, false, 300, true},
+		{PolicyMin, 100, 0, true, 100, false},
+		{PolicyMin, 0, 0, true, 0, false},
+		{PolicyMax, 100, 300, false, 300, true},
+		{PolicyMax, 300, 100, true, 300, false},
+		{PolicyMax, 100, 0, true, 100, false},
+	}
+	for _, test := range tests {
+		o := applyPolicy(test.policy, finishOffers(test.market, test.foil), test.isFoil)
+		if o.Price.Cents != test.price || (test.price > 0 && o.Foil != test.pick) {
+			t.Errorf("applyPolicy(%q, %d, %d, foil %t) = %d foil %t, want %d foil %t",
+				test.policy, test.market, test.foil, test.isFoil,
+				o.Price.Cents, o.Foil, test.price, test.pick)
+		}
+	}
+}
+
+func TestSelectOffer(t *testing.T) {
+	defer func(policies map[string]string) {
+		Config.PricePolicies = policies
+	}(Config.PricePolicies)
+	Config.PricePolicies = nil
+
+	tests := []struct {
+		name   string
+		set    string
+		isFoil bool
+		market int64
+		foil   int64
+		price  int64
+	}{
+		// promos take the lowest price, whatever their finish
+		{"Bribery (DCI Judge Foil)", "Promotional DCI Judge", true, 2000, 3000, 2000},
+		{"Bribery (DCI Judge Foil)", "Promotional DCI Judge", false, 2000, 3000, 2000},
+		{"Bribery (DCI Judge Foil)", "Promotional DCI Judge", true, 3000, 2000, 2000},
+		{"Bribery (DCI Judge Foil)", "Promotional DCI Judge", false, 3000, 2000, 2000},
+		{"Bribery (DCI Judge Foil)", "Promotional DCI Judge", true, 0, 3000, 3000},
+		{"Bribery (DCI Judge Foil)", "Promotional DCI Judge", false, 2000, 0, 2000},
+		{"Bribery (DCI Judge Foil)", "Promotional DCI Judge", true, 2000, 0, 2000},
+		{"Glorybringer", "Prerelease Stamped", true, 500, 800, 500},
+		{"Glorybringer", "Prerelease Stamped", true, 900, 800, 800},
+		{"Glorybringer", "Prerelease Stamped", false, 0, 800, 800},
+
+		// regular cards use the matching finish only
+		{"Serra Angel", "Revised Edition", false, 100, 300, 100},
+		{"Aether Vial", "Darksteel", true, 1200, 0, 0},
+	}
+	for _, test := range tests {
+		c := card{Name: test.name, Set: test.set, Foil: test.isFoil}
+		o := selectOffer(finishOffers(test.market, test.foil), c)
+		if o.Price.Cents != test.price {
+			t.Errorf("selectOffer(%s, %s, foil %t, %d, %d) = %d, want %d",
+				test.name, test.set, test.isFoil, test.market, test.foil, o.Price.Cents, test.price)
+		}
+	}
+
+	// every policy can be configured for every category
+	for _, policy := range pricePolicies {
+		for _, set := range []string{"Promotional", "Prerelease Stamped", "Revised Edition"} {
+			Config.PricePolicies = map[string]string{setCategory(set): policy}
+			want := applyPolicy(policy, finishOffers(300, 100), false)
+			o := selectOffer(finishOffers(300, 100), card{Name: "Card", Set: set})
+			if o != want {
+				t.Errorf("selectOffer with %q for %s = %+v, want %+v", policy, set, o, want)
+			}
+		}
+	}
+}
+
+func TestValidatePolicies(t *testing.T) {
+	defer func(policies map[string]string) {
+		Config.PricePolicies = policies
+	}(Config.PricePolicies)
+
+	tests := []struct {
+		policies map[string]string
+		valid    bool
+	}{
+		{nil, true},
+		{map[string]string{CategoryPromo: PolicyFoil, CategoryDefault: PolicyPreferMatching}, true},
+		{map[string]string{CategoryPrerelease: PolicyMax}, true},
+		{map[string]string{"masterpiece": PolicyMin}, false},
+		{map[string]string{CategoryPromo: "cheapest"}, false},
+		{map[string]string{CategoryDefault: ""}, false},
+	}
+	for _, test := range tests {
+		Config.PricePolicies = test.policies
+		err := validatePolicies()
+		if (err == nil) != test.valid {
+			t.Errorf("validatePolicies(%v) = %v, want valid %t", test.policies, err, test.valid)
+		}
+	}
+}
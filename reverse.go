@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A CK name and set pair
+type ckCard struct {
+	name string
+	set  string
+}
+
+// Promotional qualifiers tried when looking for a CK promo, the remaining
+// CK qualifiers all end up in "Promotional Other", so "*" is used to
+// signal that any of them is fine
+var reversePromoQualifiers = []struct {
+	qualifier string
+	extra     string
+}{
+	{"*", ""},
+	{"2018 Gift Pack", ""},
+	{"Arena Foil", ""},
+	{"Buy-A-Box Foil", ""},
+	{"FNM Foil", ""},
+	{"Gateway Foil", ""},
+	{"JSS Foil", ""},
+	{"Judge Foil", ""},
+	{"Judge Foil", "2013"},
+	{"Junior Super Series Foil", ""},
+	{"Launch Foil", ""},
+	{"Player Reward Foil", ""},
+	{"Prerelease Foil", ""},
+	{"Release Foil", ""},
+	{"Textless Foil", ""},
+	{"WPN Foil", ""},
+}
+
+// CS splits guild kits by guild, CK by set
+var guildKitSets = map[string]string{
+	"Boros":    "Guilds of Ravnica: Guild Kits",
+	"Dimir":    "Guilds of Ravnica: Guild Kits",
+	"Golgari":  "Guilds of Ravnica: Guild Kits",
+	"Izzet":    "Guilds of Ravnica: Guild Kits",
+	"Selesnya": "Guilds of Ravnica: Guild Kits",
+	"Azorius":  "Ravnica Allegiance: Guild Kits",
+	"Gruul":    "Ravnica Allegiance: Guild Kits",
+	"Orzhov":   "Ravnica Allegiance: Guild Kits",
+	"Rakdos":   "Ravnica Allegiance: Guild Kits",
+	"Simic":    "Ravnica Allegiance: Guild Kits",
+}
+
+// Undo the character replacements done on these sets
+var colonSets = []string{
+	"Duel Decks",
+	"From the Vault",
+	"Global Series",
+	"Premium Deck Series",
+	"Signature Spellbook",
+}
+
+// Undo the Duel Decks name fixes
+var duelDeckFixes = [][2]string{
+	{" (2014)", ""},
+	{"vs.", "Vs."},
+	{"Kiora Vs. Elspeth", "Elspeth Vs. Kiora"},
+	{"the Coalition", "The Coalition"},
+	{" and ", " & "},
+}
+
+// Apply every combination of the given replacements to s
+func expandVariants(s string, fixes [][2]string) []string {
+	variants := []string{s}
+	for _, fix := range fixes {
+		for _, variant := range variants {
+			if strings.Contains(variant, fix[0]) {
+				variants = append(variants, strings.Replace(variant, fix[0], fix[1], 1))
+			}
+		}
+	}
+	return variants
+}
+
+// Sets that exist only on CS, produced by the special cases of processRecord
+func isCSOnlySet(cardSet string) bool {
+	return cardSet == "Prerelease Stamped" ||
+		strings.HasPrefix(cardSet, "Promotional") ||
+		strings.HasPrefix(cardSet, "Guild Kit ") ||
+		strings.HasPrefix(cardSet, "Duel Decks Anthology, ")
+}
+
+// Names that may have been converted to the given CS name, the name is
+// kept as is only when no table produces it
+func reverseNames(cardName, cardSet string) []string {
+	names := csStyle.unrender(cardName, cardSet)
+	for ck, cs := range aetherMess {
+		if sameName(cs, cardName) {
+			names = append(names, ck)
+		}
+	}
+	for ck, cs := range anyVariant {
+		if sameName(cs, cardName) {
+			names = append(names, ck)
+		}
+	}
+	for ck, sets := range urzaLands {
+		if sameName(sets[cardSet], cardName) {
+			names = append(names, ck)
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, cardName)
+	}
+	return names
+}
+
+// Sets that may have been converted to the given CS set, each with an
+// optional suffix to be appended to the card name
+func reverseSets(cardSet string) []ckCard {
+	var sets []ckCard
+	for ck, cs := range setMap {
+		if cs == cardSet {
+			sets = append(sets, ckCard{set: ck})
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(cardSet, "Guild Kit "):
+		set, found := guildKitSets[strings.TrimPrefix(cardSet, "Guild Kit ")]
+		if found {
+			sets = append(sets, ckCard{set: set})
+		}
+	case strings.HasPrefix(cardSet, "Duel Decks Anthology, "):
+		deck := strings.TrimPrefix(cardSet, "Duel Decks Anthology, ")
+		for _, variant := range expandVariants(deck, duelDeckFixes) {
+			sets = append(sets,
+				ckCard{name: " (" + variant + ")", set: "Duel Decks Anthology"},
+				ckCard{name: " (" + variant + " - Foil)", set: "Duel Decks Anthology"})
+		}
+	default:
+		for _, prefix := range colonSets {
+			if strings.HasPrefix(cardSet, prefix) {
+				fixes := append([][2]string{{prefix, prefix + ":"}}, duelDeckFixes...)
+				for _, variant := range expandVariants(cardSet, fixes) {
+					if strings.HasPrefix(variant, prefix+":") {
+						sets = append(sets, ckCard{set: variant})
+					}
+				}
+				break
+			}
+		}
+	}
+	if len(sets) == 0 && !isCSOnlySet(cardSet) {
+		sets = append(sets, ckCard{set: cardSet})
+	}
+	return sets
+}
+
+// Find every CK variant that translates to the given CS card, each
+// candidate is checked against processRecord so that the two directions
+// never disagree, and more than one result means the CS card is ambiguous
+func reverseRecord(cardName, cardSet string) []ckCard {
+	var found []ckCard
+	seen := map[ckCard]bool{}
+	check := func(candidate ckCard) bool {
+		if seen[candidate] {
+			return false
+		}
+		seen[candidate] = true
+
+		csName, csSet, err := processRecord(candidate.name, candidate.set)
+		if err != nil || !sameName(csName, cardName) || csSet != cardSet {
+			return false
+		}
+		found = append(found, candidate)
+		return true
+	}
+
+	for _, set := range reverseSets(cardSet) {
+		for _, name := range reverseNames(cardName, cardSet) {
+			check(ckCard{name: name + set.name, set: set.set})
+		}
+	}
+
+	// CK moves the custom CS tag in the promo qualifier
+	names := reverseNames(cardName, cardSet)
+	s := strings.Split(cardName, " (")
+	if len(s) > 1 {
+		names = reverseNames(strings.Join(s[:len(s)-1], " ("), cardSet)
+	}
+	for _, name := range names {
+		matched := map[string]bool{}
+		for _, promo := range reversePromoQualifiers {
+			// a matching "*" already covers every other qualifier, and
+			// the extra is only needed when the plain qualifier misses
+			if matched["*"] || matched[promo.qualifier] {
+				continue
+			}
+			qualifier := promo.qualifier
+			if promo.extra != "" {
+				qualifier = fmt.Sprintf("%s (%s)", qualifier, promo.extra)
+			}
+			candidate := ckCard{
+				name: fmt.Sprintf("%s (%s)", name, qualifier),
+				set:  "Promotional",
+			}
+			if check(candidate) {
+				matched[promo.qualifier] = true
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].set != found[j].set {
+			return found[i].set < found[j].set
+		}
+		return found[i].name < found[j].name
+	})
+	return found
+}
+
+// Convert a csv of CS cards (with a "Name" and a "Set" column) to CK ones,
+// one row per variant found
+func reverseCards(args []string) int {
+	l := log.New(os.Stderr, "", 0)
+
+	if len(args) < 1 {
+		log.Fatal(fmt.Errorf("usage: <exe> reverse <csv>"))
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		log.Fatal("Error reading header: " + err.Error())
+	}
+	idx, err := findColumns(header, "Name", "Set")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	defer w.Flush()
+	w.Write([]string{"Name", "Set", "CK Name", "CK Set"})
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			l.Printf("Error reading record: %s", err.Error())
+			break
+		}
+		if len(record) <= idx[0] || len(record) <= idx[1] {
+			continue
+		}
+
+		cardName := strings.TrimSpace(record[idx[0]])
+		cardSet := strings.TrimSpace(record[idx[1]])
+		variants := reverseRecord(cardName, cardSet)
+		switch len(variants) {
+		case 0:
+			l.Printf("No CK variant found: (%s/%s)", cardName, cardSet)
+			continue
+		case 1:
+		default:
+			l.Printf("Ambiguous record: (%s/%s) maps to %d CK variants", cardName, cardSet, len(variants))
+		}
+		for _, variant := range variants {
+			w.Write([]string{cardName, cardSet, variant.name, variant.set})
+		}
+	}
+	return 0
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReverseRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		set  string
+		ck   ckCard
+	}{
+		{"Sakura Tribe Elder", "Champions of Kamigawa", ckCard{"Sakura-Tribe Elder", "Champions of Kamigawa"}},
+		{"Sakura-Tribe Elder", "Tenth Edition", ckCard{"Sakura-Tribe Elder", "10th Edition"}},
+		{"Lim Dûl's Cohort", "Alliances", ckCard{"Lim-Dul's Cohort", "Alliances"}},
+		{"Infiltrator’s Magemark", "Dissension", ckCard{"Infiltrator's Magemark", "Dissension"}},
+	}
+	for _, test := range tests {
+		cards := reverseRecord(test.name, test.set)
+		if len(cards) != 1 || cards[0] != test.ck {
+			t.Errorf("reverseRecord(%q, %q) = %v, want %v", test.name, test.set, cards, test.ck)
+		}
+	}
+}
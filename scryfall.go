@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The fields of a Scryfall card object that identify a printing
+type scryfallCard struct {
+	ID              string   `json:"id"`
+	Name            string   `json:"name"`
+	Lang            string   `json:"lang"`
+	Set             string   `json:"set"`
+	SetName         string   `json:"set_name"`
+	CollectorNumber string   `json:"collector_number"`
+	Digital         bool     `json:"digital"`
+	Promo           bool     `json:"promo"`
+	PromoTypes      []string `json:"promo_types"`
+	FrameEffects    []string `json:"frame_effects"`
+	BorderColor     string   `json:"border_color"`
+	Variation       bool     `json:"variation"`
+}
+
+// A regular printing, without any promo or frame treatment
+func (card *scryfallCard) isPlain() bool {
+	if card.Promo || card.Variation || card.Digital ||
+		card.BorderColor == "borderless" || len(card.PromoTypes) > 0 {
+		return false
+	}
+	for _, effect := range card.FrameEffects {
+		switch effect {
+		case "showcase", "extendedart", "inverted":
+			return false
+		}
+	}
+	return true
+}
+
+// Scryfall (and MTGJSON) sets that CS names differently, in addition to the dropped ':'
+var scryfallSetMap = map[string]string{
+	"Commander 2013":                "Commander 2013 Edition",
+	"Commander Anthology Volume II": "Commander Anthology 2018",
+	"Duel Decks: Annihilation":      "Duel Decks Annihilation (2014)",
+	"Duel Decks: Elspeth vs. Kiora": "Duel Decks Kiora vs. Elspeth",
+	"Magic 2014":                    "Magic 2014 Core Set",
+	"Magic 2015":                    "Magic 2015 Core Set",
+	"Modern Masters 2015":           "Modern Masters 2015 Edition",
+	"Modern Masters 2017":           "Modern Masters 2017 Edition",
+	"Planechase 2012":               "Planechase 2012 Edition",
+	"Shards of Alara":               "Shards Of Alara",
+}
+
+// Set names are compared without punctuation differences
+func foldSet(cardSet string) string {
+	cardSet = strings.Replace(cardSet, ":", "", -1)
+	cardSet = strings.Replace(cardSet, "&", "and", -1)
+	return foldName(cardSet)
+}
+
+// English printings from a Scryfall bulk data file
+type scryfallDB struct {
+	cards map[string]map[string][]*scryfallCard // set -> name -> printings
+}
+
+var scryfallCards *scryfallDB
+
+// Load any of the Scryfall bulk files, they are a large array so they are
+// decoded one card at a time
+func loadScryfall(path string) (*scryfallDB, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db := &scryfallDB{
+		cards: map[string]map[string][]*scryfallCard{},
+	}
+
+	dec := json.NewDecoder(file)
+	_, err = dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding %s: %s", path, err.Error())
+	}
+	for dec.More() {
+		var card scryfallCard
+		err = dec.Decode(&card)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding %s: %s", path, err.Error())
+		}
+		if card.Lang != "" && card.Lang != "en" {
+			continue
+		}
+
+		set := foldSet(card.SetName)
+		names, found := db.cards[set]
+		if !found {
+			names = map[string][]*scryfallCard{}
+			db.cards[set] = names
+		}
+		name := foldName(card.Name)
+		names[name] = append(names[name], &card)
+	}
+
+	return db, nil
+}
+
+// Find the only plain printing of a CK card, variants and promos are left
+// to processRecord
+func (db *scryfallDB) resolve(cardName, cardSet string) (*scryfallCard, bool) {
+	if strings.Contains(cardName, "(") || strings.Contains(cardName, "//") {
+		return nil, false
+	}
+
+	sets := []string{cardSet}
+	entry, found := setMap[cardSet]
+	if found {
+		sets = append(sets, entry)
+	}
+
+	var match *scryfallCard
+	for _, set := range sets {
+		for _, card := range db.cards[foldSet(set)][foldName(cardName)] {
+			if !card.isPlain() {
+				continue
+			}
+			// more than one plain printing is as good as none
+			if match != nil && match.ID != card.ID {
+				return nil, false
+			}
+			match = card
+		}
+	}
+	return match, match != nil
+}
+
+// The CS name of a set, given the one used by Scryfall and MTGJSON
+func canonicalCSSet(setName string) string {
+	cardSet, found := scryfallSetMap[setName]
+	if !found {
+		cardSet = strings.Replace(setName, ":", "", 1)
+		cardSet = strings.Replace(cardSet, "&", "and", 1)
+	}
+	return cardSet
+}
+
+// The CS version of a Scryfall printing
+func (card *scryfallCard) csCard() (string, string) {
+	cardSet := canonicalCSSet(card.SetName)
+	return csCardName(card.Name, cardSet), cardSet
+}
+
+// Convert a CK card to CS, identifying the printing via Scryfall when the
+// bulk data is loaded, and processRecord otherwise; the Scryfall ID is
+// returned when found
+func translate(cardName, cardSet string) (string, string, string, error) {
+	if scryfallCards != nil && !skipCard(cardName, cardSet) {
+		card, found := scryfallCards.resolve(cardName, cardSet)
+		if found {
+			csName, csSet := card.csCard()
+			return csName, csSet, card.ID, nil
+		}
+	}
+
+	csName, csSet, err := processRecord(cardName, cardSet)
+	return csName, csSet, "", err
+}
+
+// Load the Scryfall bulk data if configured
+func loadScryfallConfig() error {
+	if Config.ScryfallFile == "" {
+		return nil
+	}
+	db, err := loadScryfall(Config.ScryfallFile)
+	if err != nil {
+		return err
+	}
+	scryfallCards = db
+	return nil
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default address of the server
+const ServeAddr = "localhost:8080"
+
+// Largest buylist accepted by POST /api/runs
+const maxUploadSize = 32 << 20
+
+// Status of a run started by the server, or found in the results dir
+type serverRun struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// Runs are named after the time they started, as the daemon does
+const runIDFormat = "2006-01-02T150405"
+
+const (
+	runQueued  = "queued"
+	runRunning = "running"
+	runDone    = "done"
+	runFailed  = "failed"
+)
+
+// The server state: the runs are kept in the results dir, and executed
+// one at a time
+type server struct {
+	sources []PriceSource
+
+	mu   sync.Mutex
+	runs map[string]*serverRun
+
+	// held while a run is in progress
+	running sync.Mutex
+}
+
+func newServer(sources []PriceSource) (*server, error) {
+	srv := &server{
+		sources: sources,
+		runs:    map[string]*serverRun{},
+	}
+
+	// the output of the previous runs, daemon ones included
+	err := os.MkdirAll(Config.ResultsDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(Config.ResultsDir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".csv")
+		if strings.HasSuffix(id, "-input") || strings.HasSuffix(id, "-unmatched") {
+			continue
+		}
+		run := &serverRun{ID: id, Status: runDone}
+		if len(id) >= len(runIDFormat) {
+			run.Started, _ = time.ParseInLocation(runIDFormat, id[:len(runIDFormat)], time.Local)
+		}
+		srv.runs[id] = run
+	}
+	return srv, nil
+}
+
+func (srv *server) resultsPath(id string) string {
+	return filepath.Join(Config.ResultsDir, id+".csv")
+}
+
+func (srv *server) inputPath(id string) string {
+	return filepath.Join(Config.ResultsDir, id+"-input.csv")
+}
+
+func (srv *server) unmatchedPath(id string) string {
+	return filepath.Join(Config.ResultsDir, id+"-unmatched.csv")
+}
+
+// A copy of the run, safe to encode while the run changes
+func (srv *server) run(id string) (serverRun, bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	run, found := srv.runs[id]
+	if !found {
+		return serverRun{}, false
+	}
+	return *run, true
+}
+
+func (srv *server) listRuns() []serverRun {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	runs := make([]serverRun, 0, len(srv.runs))
+	for _, run := range srv.runs {
+		runs = append(runs, *run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].ID > runs[j].ID
+	})
+	return runs
+}
+
+func (srv *server) setStatus(id, status string, err error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	run := srv.runs[id]
+	run.Status = status
+	if status == runDone || status == runFailed {
+		now := time.Now()
+		run.Finished = &now
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+}
+
+// Store the uploaded buylist and queue a run on it
+func (srv *server) startRun(r io.Reader) (serverRun, error) {
+	srv.mu.Lock()
+	started := time.Now()
+	id := started.Format(runIDFormat)
+	for i := 2; srv.runs[id] != nil; i++ {
+		id = fmt.Sprintf("%s-%d", started.Format(runIDFormat), i)
+	}
+	run := &serverRun{ID: id, Status: runQueued, Started: started}
+	srv.runs[id] = run
+	queued := *run
+	srv.mu.Unlock()
+
+	input, err := os.Create(srv.inputPath(id))
+	if err == nil {
+		_, err = io.Copy(input, r)
+		input.Close()
+	}
+	if err != nil {
+		srv.setStatus(id, runFailed, err)
+		failed, _ := srv.run(id)
+		return failed, err
+	}
+
+	go func() {
+		srv.running.Lock()
+		defer srv.running.Unlock()
+
+		srv.setStatus(id, runRunning, nil)
+		out, err := os.Create(srv.resultsPath(id))
+		if err == nil {
+			var unmatched *os.File
+			unmatched, err = os.Create(srv.unmatchedPath(id))
+			if err == nil {
+				err = arbitrage(context.Background(), srv.sources, srv.inputPath(id), time.Time{}, out, unmatched)
+				unmatched.Close()
+			}
+			out.Close()
+		}
+		if err != nil {
+			srv.setStatus(id, runFailed, err)
+			return
+		}
+		srv.setStatus(id, runDone, nil)
+	}()
+	return queued, nil
+}
+
+// Read the output of a run as a list of column -> value
+func readRunResults(path string) ([]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows := []map[string]string{}
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return rows, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := map[string]string{}
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// The CK card in the query, converted to CS
+func queryCard(r *http.Request) (card, error) {
+	q := r.URL.Query()
+	name, set := q.Get("name"), q.Get("set")
+	if name == "" || set == "" {
+		return card{}, fmt.Errorf("missing name or set")
+	}
+	cardName, cardSet, scryfallID, err := translate(name, set)
+	if err != nil {
+		return card{}, err
+	}
+	if cardName == "" || cardSet == "" {
+		return card{}, fmt.Errorf("%s (%s) is not on CardShark", name, set)
+	}
+	return card{
+		Name:       cardName,
+		Set:        cardSet,
+		Foil:       parseFoil(q.Get("foil")),
+		ScryfallID: scryfallID,
+		Condition:  "NM",
+		Language:   ckLanguage(name, set),
+	}, nil
+}
+
+// GET /api/translate?name=<CK name>&set=<CK set>
+func (srv *server) handleTranslate(w http.ResponseWriter, r *http.Request) {
+	c, err := queryCard(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"name":        c.Name,
+		"set":         c.Set,
+		"scryfall_id": c.ScryfallID,
+		"language":    c.Language,
+	})
+}
+
+// GET /api/price?name=<CK name>&set=<CK set>[&foil=1]
+func (srv *server) handlePrice(w http.ResponseWriter, r *http.Request) {
+	c, err := queryCard(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	type jsonOffer struct {
+		Source   string  `json:"source"`
+		Price    float64 `json:"price"`
+		Currency string  `json:"currency"`
+		Foil     bool    `json:"foil"`
+		URL      string  `json:"url"`
+	}
+	offers := []jsonOffer{}
+	var errs []string
+	exhausted := false
+	for i, reply := range lookupAll(r.Context(), srv.sources, c) {
+		if reply.err == errCardNotFound {
+			continue
+		} else if reply.err == errBudgetExhausted {
+			// the other sources may still have a price
+			exhausted = true
+			continue
+		} else if reply.err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", srv.sources[i].Name(), reply.err.Error()))
+			continue
+		}
+		for _, o := range reply.offers {
+			if !o.Price.IsPositive() {
+				continue
+			}
+			offers = append(offers, jsonOffer{o.Source, o.Price.Float(), o.Price.Currency, o.Foil, o.URL})
+		}
+	}
+	if len(offers) == 0 && exhausted {
+		writeError(w, http.StatusTooManyRequests, errBudgetExhausted)
+		return
+	}
+	if len(offers) == 0 && len(errs) > 0 {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("%s", strings.Join(errs, "; ")))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":   c.Name,
+		"set":    c.Set,
+		"foil":   c.Foil,
+		"offers": offers,
+	})
+}
+
+// GET /api/runs lists the runs, POST /api/runs starts one on the csv in
+// the body, either raw or as the "file" of a multipart form
+func (srv *server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, srv.listRuns())
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+		var body io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			defer file.Close()
+			body = file
+		}
+
+		// read first, so that a body too large fails the request and
+		// not the run
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			status := http.StatusBadRequest
+			if len(data) >= maxUploadSize {
+				status = http.StatusRequestEntityTooLarge
+			}
+			writeError(w, status, err)
+			return
+		}
+		run, err := srv.startRun(bytes.NewReader(data))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, run)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+	}
+}
+
+// GET /api/runs/<id> is the status of a run, /api/runs/<id>/results its
+// output, as JSON unless ?format=csv
+func (srv *server) handleRun(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/runs/"), "/")
+	run, found := srv.run(parts[0])
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no run %q", parts[0]))
+		return
+	}
+	if len(parts) == 1 {
+		writeJSON(w, http.StatusOK, run)
+		return
+	}
+	if len(parts) > 2 || parts[1] != "results" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if run.Status != runDone {
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s is %s", run.ID, run.Status))
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		data, err := ioutil.ReadFile(srv.resultsPath(run.ID))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write(data)
+		return
+	}
+	rows, err := readRunResults(srv.resultsPath(run.ID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rows)
+}
+
+func (srv *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/translate", srv.handleTranslate)
+	mux.HandleFunc("/api/price", srv.handlePrice)
+	mux.HandleFunc("/api/runs", srv.handleRuns)
+	mux.HandleFunc("/api/runs/", srv.handleRun)
+	mux.HandleFunc("/", srv.handleIndex)
+	mux.HandleFunc("/runs/", srv.handleRunPage)
+	mux.HandleFunc("/history", srv.handleHistoryPage)
+	return mux
+}
+
+// Serve the lookups and runs over HTTP, the address defaults to the
+// serve_addr of the config
+func serveCmd(args []string) int {
+	sources := setup()
+
+	ttl, err := time.ParseDuration(Config.CacheTTL)
+	if err != nil || ttl <= 0 {
+		log.Fatal(fmt.Errorf("Invalid cache_ttl %q in %s", Config.CacheTTL, ConfigFile))
+	}
+	srv, err := newServer(cacheSources(sources, ttl))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	addr := Config.ServeAddr
+	if len(args) > 0 {
+		addr = args[0]
+	}
+	log.New(os.Stderr, "", 0).Printf("Listening on http://%s", addr)
+	log.Fatal(http.ListenAndServe(addr, srv.handler()))
+	return 0
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A card as looked up on a price source, name and set follow the CS
+// conventions, which act as common identity across sources
+type card struct {
+	Name       string
+	Set        string
+	Foil       bool
+	ScryfallID string
+
+	// the worst condition acceptable, empty means NM
+	Condition string
+
+	// empty for English, see LanguageSource
+	Language string
+}
+
+// A price for a card on a marketplace
+type offer struct {
+	Source string
+	Price  Money
+	Foil   bool
+	URL    string
+
+	// empty for sources that only list NM cards
+	Condition string
+
+	// empty for English, see LanguageSource
+	Language string
+
+	// set when the price given by the source could not be parsed
+	Warn error
+}
+
+// PriceSource is a marketplace that can be queried for the offers on a card
+type PriceSource interface {
+	Name() string
+	Lookup(ctx context.Context, c card) ([]offer, error)
+}
+
+// Returned by a PriceSource that does not know the card
+var errCardNotFound = errors.New("card not found")
+
+// Sources available in the config, by name
+var priceSources = map[string]func() (PriceSource, error){}
+
+func registerSource(name string, ctor func() (PriceSource, error)) {
+	priceSources[name] = ctor
+}
+
+func newPriceSource(name string) (PriceSource, error) {
+	ctor, found := priceSources[name]
+	if !found {
+		names := make([]string, 0, len(priceSources))
+		for name := range priceSources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unknown price source %q, available: %s", name, strings.Join(names, ", "))
+	}
+	return ctor()
+}
+
+// Index key of the sources loaded from a file
+func offerKey(cardName, cardSet string) string {
+	return foldSet(cardSet) + "|" + foldName(cardName)
+}
+
+// The set of a source loaded from a file corresponding to a CS one: its
+// own name if it has one in sets, else the Scryfall name
+func sourceSet(cardSet string, sets map[string]string) string {
+	entry, found := sets[cardSet]
+	if found {
+		return entry
+	}
+	for scryfall, cs := range scryfallSetMap {
+		if cs == cardSet {
+			return scryfall
+		}
+	}
+	return cardSet
+}
+
+// Unparsable prices of a file are reported, the rest of it is still usable
+func warnRecord(src PriceSource, err error, record []string) {
+	l := log.New(os.Stderr, "", 0)
+	l.Printf("Warning: %s %s %q", src.Name(), err.Error(), record)
+}
+
+// Keep only the cheapest offer in each finish
+func cheapestOffers(offers []offer) []offer {
+	var cheapest []offer
+	for _, isFoil := range []bool{false, true} {
+		var best *offer
+		for i := range offers {
+			if offers[i].Foil == isFoil && (best == nil || offers[i].Price.Cents < best.Price.Cents) {
+				best = &offers[i]
+			}
+		}
+		if best != nil {
+			cheapest = append(cheapest, *best)
+		}
+	}
+	return cheapest
+}
+
+// The offer in the given finish, if any
+func findOffer(offers []offer, foil bool) (offer, bool) {
+	for _, o := range offers {
+		if o.Foil == foil {
+			return o, true
+		}
+	}
+	return offer{}, false
+}
+
+// The reply of a source to a lookup
+type sourceReply struct {
+	offers []offer
+	err    error
+}
+
+// Query every source at the same time, replies are in the same order
+func lookupAll(ctx context.Context, sources []PriceSource, c card) []sourceReply {
+	replies := make([]sourceReply, len(sources))
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func(i int, src PriceSource) {
+			replies[i].offers, replies[i].err = src.Lookup(ctx, c)
+			wg.Done()
+		}(i, src)
+	}
+	wg.Wait()
+	return replies
+}
+
+// Pick the offer to compare with the buylist price, as set by the policy
+// for the category of the set
+func selectOffer(offers []offer, c card) offer {
+	return applyPolicy(pricePolicy(c.Set), offers, c.Foil)
+}
+
+// Sort the offers from the cheapest, dropping the ones without a price
+func rankOffers(offers []offer) []offer {
+	var ranked []offer
+	for _, o := range offers {
+		if o.Price.IsPositive() {
+			ranked = append(ranked, o)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Price.Cents < ranked[j].Price.Cents
+	})
+	return ranked
+}
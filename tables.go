@@ -516,6 +516,13 @@ var aetherMess = map[string]string{
 	"Yet Another Aether Vortex": "Yet Another Æther Vortex",
 }
 
+// aetherMess is not applied to these, they use the modern spelling
+var aetherSets = []string{
+	"Commander 2018",
+	"Explorers of Ixalan",
+	"Iconic Masters",
+}
+
 var urzaLands = map[string]map[string]string{
 	"Urza's Power Plant (Bug)": map[string]string{
 		"Antiquities": "Urza's Power Plant (bug)",
@@ -1100,3 +1107,41 @@ var skippablePromos = []string{
 	"Welcome 2016",
 	"XBox Promo",
 }
+
+// CS spelling of names, regardless of accents, quotes and case
+var csNameRules = []renderRule{
+	// These cards only need replacement for some reprints (but not all)
+	{"Altar of Dementia", "Tempest", "Altar Of Dementia"},
+	{"Furnace of Rath", "Tempest", "Furnace Of Rath"},
+	{"Commune with Nature", "Champions of Kamigawa", "Commune With Nature"},
+	{"Higure, the Still Wind", "Betrayers of Kamigawa", "Higure, The Still Wind"},
+	{"Flame-Kin Zealot", "Ravnica City of Guilds", "Flame kin Zealot"},
+
+	// CK tyops
+	{"Okiba-Gang Shinobi", "", "Okiba-Gang Shinobi"},
+	{"Okiba-Gang Shinobi", "Betrayers of Kamigawa", "Okiba Gang Shinobi"},
+	{"Will-o'-the-Wisp", "", "Will O' The Wisp"},
+	{"Will-o'-the-Wisp", "Ninth Edition", "Will o' the Wisp"},
+	{"Will-o'-the-Wisp", "Masters 25", "Will-o'-the-Wisp"},
+
+	// I wonder why CS hates limdul
+	{"Lim-Dul the Necromancer", "", "Lim Dul the Necromancer"},
+	{"Lim-Dul's High Guard", "", "Lim Dul's High Guard"},
+	{"Lim-Dul's Vault", "Commander 2013 Edition", "Lim-Dûl's Vault"},
+
+	// I wonder why CS hates steve
+	{"Sakura-Tribe Elder (FNM 2009)", "Promotional Friday Night Magic", "Sakura - Tribe Elder (FNM 2009)"},
+}
+
+var csSubstitutions = []substitution{
+	// CS hates magemarks
+	{"Magemark", nil, "'", "’"},
+	{"Lim-Dul", nil, "Lim-Dul", "Lim Dûl"},
+	{"Sakura-Tribe", []string{
+		"Archenemy",
+		"Betrayers of Kamigawa",
+		"Champions of Kamigawa",
+		"Promotional Jr Super Series",
+		"World Championship Decks",
+	}, "-", " "},
+}
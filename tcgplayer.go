@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// CS sets that TCGplayer names differently, in addition to the Scryfall ones
+var tcgSetMap = map[string]string{
+	"Magic 2010":              "Magic 2010 (M10)",
+	"Magic 2011":              "Magic 2011 (M11)",
+	"Magic 2012":              "Magic 2012 (M12)",
+	"Magic 2013":              "Magic 2013 (M13)",
+	"Magic 2014 Core Set":     "Magic 2014 (M14)",
+	"Magic 2015 Core Set":     "Magic 2015 (M15)",
+	"Time Spiral Timeshifted": "Timeshifted",
+}
+
+// A pricing csv exported from TCGplayer, used instead of querying a
+// marketplace
+type tcgPlayer struct {
+	offers map[string][]offer // set|name -> offers
+
+	// the languages listed, when the csv has a "Language" column
+	languages map[string]bool
+}
+
+func init() {
+	registerSource("tcgplayer", newTCGplayer)
+}
+
+func newTCGplayer() (PriceSource, error) {
+	if Config.TCGplayerFile == "" {
+		return nil, fmt.Errorf("Missing tcgplayer_file in %s", ConfigFile)
+	}
+	file, err := os.Open(Config.TCGplayerFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tcg := &tcgPlayer{
+		offers:    map[string][]offer{},
+		languages: map[string]bool{},
+	}
+	err = tcg.load(file)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading %s: %s", Config.TCGplayerFile, err.Error())
+	}
+	return tcg, nil
+}
+
+func (tcg *tcgPlayer) load(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	idx, err := findColumns(header, "TCGplayer Id", "Set Name", "Product Name",
+		"Condition", "TCG Market Price", "TCG Low Price")
+	if err != nil {
+		return err
+	}
+	langIdx := optionalColumn(header, "Language")
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		field := func(i int) string {
+			if idx[i] >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[idx[i]])
+		}
+
+		// conditions are listed as "Near Mint" or "Near Mint Foil", the
+		// ones not bought by CK are skipped
+		condition := field(3)
+		isFoil := strings.HasSuffix(condition, " Foil")
+		condition, err = parseCondition(strings.TrimSuffix(condition, " Foil"))
+		if err != nil {
+			continue
+		}
+
+		lang := ""
+		if langIdx >= 0 && langIdx < len(record) {
+			lang, err = parseLanguage(record[langIdx])
+			if err != nil {
+				warnRecord(tcg, err, record)
+				continue
+			}
+			tcg.languages[lang] = true
+		}
+
+		// prefer the lowest listing, the market price is an average
+		price, err := parseMoney(field(5), BaseCurrency)
+		if err != nil {
+			warnRecord(tcg, err, record)
+		}
+		if !price.IsPositive() {
+			price, err = parseMoney(field(4), BaseCurrency)
+			if err != nil {
+				warnRecord(tcg, err, record)
+			}
+		}
+		if !price.IsPositive() {
+			continue
+		}
+
+		key := offerKey(field(2), field(1))
+		tcg.offers[key] = append(tcg.offers[key], offer{
+			Source:    tcg.Name(),
+			Price:     price,
+			Foil:      isFoil,
+			URL:       "https://www.tcgplayer.com/product/" + field(0),
+			Condition: condition,
+			Language:  lang,
+		})
+	}
+	return nil
+}
+
+func (tcg *tcgPlayer) Name() string {
+	return "tcgplayer"
+}
+
+func (tcg *tcgPlayer) Lookup(ctx context.Context, c card) ([]offer, error) {
+	var offers []offer
+	for _, o := range tcg.offers[offerKey(c.Name, sourceSet(c.Set, tcgSetMap))] {
+		if o.Language == c.Language {
+			offers = append(offers, o)
+		}
+	}
+	if len(offers) == 0 {
+		return nil, errCardNotFound
+	}
+	return offers, nil
+}
+
+// Only the languages found in the csv, an unknown one can't be matched
+func (tcg *tcgPlayer) SupportsLanguage(lang string) bool {
+	return tcg.languages[lang]
+}
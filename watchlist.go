@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A watched card, using the CS names as in the output; an empty set
+// matches any edition, and a target left at zero is not checked
+type watchTarget struct {
+	Name string
+	Set  string
+	// nil matches both finishes
+	Foil *bool
+
+	// alert when the spread reaches this percentage
+	Spread float64
+	// alert when the price drops to this amount
+	Price Money
+}
+
+func (t *watchTarget) matches(c card) bool {
+	if !sameName(t.Name, c.Name) {
+		return false
+	}
+	if t.Set != "" && foldSet(t.Set) != foldSet(c.Set) {
+		return false
+	}
+	return t.Foil == nil || *t.Foil == c.Foil
+}
+
+// The targets hit by a result, as a description of each
+func (t *watchTarget) hits(r result) []string {
+	var hits []string
+	if !r.price.IsPositive() {
+		return nil
+	}
+	if t.Spread > 0 && r.spread() >= t.Spread {
+		hits = append(hits, fmt.Sprintf("spread >= %0.2f%%", t.Spread))
+	}
+	if t.Price.IsPositive() {
+		target, err := t.Price.Convert(r.price.Currency)
+		if err == nil && r.price.Cents <= target.Cents {
+			hits = append(hits, fmt.Sprintf("price <= %s", target.String()))
+		}
+	}
+	return hits
+}
+
+// The watched cards, indexed by name
+type watchlist struct {
+	targets map[string][]*watchTarget
+}
+
+// Load a csv with a "Name" column, and optionally "Set", "Foil",
+// "Target Spread" (as a percentage) and "Target Price"
+func loadWatchlist(path string) (*watchlist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+	idx, err := findColumns(header, "Name")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", path, err.Error())
+	}
+	setIdx := optionalColumn(header, "Set")
+	foilIdx := optionalColumn(header, "Foil")
+	spreadIdx := optionalColumn(header, "Target Spread")
+	priceIdx := optionalColumn(header, "Target Price")
+
+	wl := &watchlist{
+		targets: map[string][]*watchTarget{},
+	}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s: %s", path, err.Error())
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		t := &watchTarget{
+			Name: field(idx[0]),
+			Set:  field(setIdx),
+		}
+		if t.Name == "" {
+			continue
+		}
+		if foilIdx >= 0 {
+			isFoil := parseFoil(field(foilIdx))
+			t.Foil = &isFoil
+		}
+		spread := strings.TrimSuffix(field(spreadIdx), "%")
+		if spread != "" {
+			t.Spread, err = strconv.ParseFloat(spread, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading %s line %d: invalid spread %q", path, line, spread)
+			}
+		}
+		t.Price, err = parseMoney(field(priceIdx), BaseCurrency)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s line %d: %s", path, line, err.Error())
+		}
+
+		key := foldName(t.Name)
+		wl.targets[key] = append(wl.targets[key], t)
+	}
+	return wl, nil
+}
+
+func (wl *watchlist) find(c card) *watchTarget {
+	for _, t := range wl.targets[foldName(c.Name)] {
+		if t.matches(c) {
+			return t
+		}
+	}
+	return nil
+}
+
+// A buylist restricted to the watched cards, the other ones are skipped
+// before any lookup is made
+type watchedBuylist struct {
+	BuylistSource
+	wl *watchlist
+}
+
+func (wb *watchedBuylist) Normalize(entry buylistEntry) (card, error) {
+	c, err := wb.BuylistSource.Normalize(entry)
+	if err != nil || c.Name == "" || c.Set == "" {
+		return c, err
+	}
+	if wb.wl.find(c) == nil {
+		return card{}, nil
+	}
+	return c, nil
+}
+
+// Query only the watched cards of a buylist, printing an alert for each
+// one that hits its target
+func watchCmd(args []string) int {
+	l := log.New(os.Stderr, "", 0)
+
+	if len(args) < 2 {
+		log.Fatal(fmt.Errorf("usage: <exe> watch <watchlist csv> <buylist csv>"))
+	}
+
+	sources := setup()
+
+	wl, err := loadWatchlist(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	file, err := os.Open(args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	bl, err := newBuylistSource(Config.BuylistFormat, file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var hist *history
+	if Config.HistoryFile != "" {
+		hist, err = openHistory(Config.HistoryFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	started := time.Now()
+
+	w := csv.NewWriter(os.Stdout)
+	defer w.Flush()
+	w.Write([]string{"URL", "Name", "Set", "Foil", "Buylist Price", "Price", "Spread", "Alert"})
+
+	watched := &watchedBuylist{bl, wl}
+	deferred, _ := processAll(context.Background(), sources, watched, time.Time{}, func(result result) {
+		for _, warn := range result.warns {
+			l.Println(warn)
+		}
+		if result.err != nil {
+			l.Println(result.err)
+			return
+		}
+		if hist != nil {
+			err := hist.addResult(started, result)
+			if err != nil {
+				l.Println("Error saving history:", err)
+			}
+		}
+
+		t := wl.find(result.card)
+		if t == nil {
+			return
+		}
+		hits := t.hits(result)
+		if len(hits) == 0 {
+			return
+		}
+		foil := ""
+		if result.isFoil {
+			foil = "X"
+		}
+		w.Write([]string{
+			result.url,
+			result.cardName,
+			result.cardSet,
+			foil,
+			result.buylistPrice.String(),
+			result.price.String(),
+			fmt.Sprintf("%0.2f%%", result.spread()),
+			strings.Join(hits, ", "),
+		})
+		w.Flush()
+	})
+
+	// only the watched cards were to be checked
+	var skipped []buylistEntry
+	for _, entry := range deferred {
+		c, err := watched.Normalize(entry)
+		if err == nil && c.Name != "" {
+			skipped = append(skipped, entry)
+		}
+	}
+	reportDeferred(skipped)
+
+	if hist != nil {
+		err = hist.Close(watchRun)
+		if err != nil {
+			l.Println("Error saving history:", err)
+		}
+	}
+	err = cardCatalogue.save(Config.CatalogueFile)
+	if err != nil {
+		l.Println("Error saving catalogue:", err)
+	}
+	return 0
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/csv"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The pages share the layout, each one defines "content"
+const layoutTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>cardsharker - {{template "title" .}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; color: #222; }
+nav a { margin-right: 1em; }
+table { border-collapse: collapse; margin-top: 1em; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em 0.8em; text-align: left; }
+th a { color: inherit; }
+td.num { text-align: right; }
+form input { margin-right: 1em; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<nav><a href="/">Runs</a><a href="/history">Card history</a></nav>
+<h1>{{template "title" .}}</h1>
+{{template "content" .}}
+</body>
+</html>
+`
+
+const runsTemplate = `{{define "title"}}Runs{{end}}
+{{define "content"}}
+{{if not .Runs}}<p>No runs yet.</p>{{else}}
+<table>
+<tr><th>Run</th><th>Status</th><th>Started</th><th>Finished</th><th></th></tr>
+{{range .Runs}}
+<tr>
+<td>{{if eq .Status "done"}}<a href="/runs/{{.ID}}">{{.ID}}</a>{{else}}{{.ID}}{{end}}</td>
+<td>{{.Status}}{{if .Error}} <span class="error">{{.Error}}</span>{{end}}</td>
+<td>{{if not .Started.IsZero}}{{.Started.Format "2006-01-02 15:04:05"}}{{end}}</td>
+<td>{{if .Finished}}{{.Finished.Format "2006-01-02 15:04:05"}}{{end}}</td>
+<td>{{if eq .Status "done"}}<a href="/runs/{{.ID}}/unmatched">unmatched</a> <a href="/api/runs/{{.ID}}/results?format=csv">csv</a>{{end}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}
+{{end}}`
+
+const runTemplate = `{{define "title"}}Run {{.ID}}{{end}}
+{{define "content"}}
+<form method="get">
+Name <input name="name" value="{{.Name}}">
+Set <input name="set" value="{{.Set}}">
+Min spread <input name="spread" value="{{.Spread}}" size="5">
+<label><input type="checkbox" name="foil" value="1"{{if .Foil}} checked{{end}}>Foil only</label>
+<input type="hidden" name="sort" value="{{.Sort}}">
+<input type="hidden" name="desc" value="{{if .Desc}}1{{end}}">
+<button>Filter</button>
+</form>
+<p>{{len .Rows}} opportunities. <a href="/runs/{{.ID}}/unmatched">Unmatched cards</a></p>
+<table>
+<tr>{{range .Columns}}<th><a href="{{.Link}}">{{.Name}}{{.Arrow}}</a></th>{{end}}</tr>
+{{range .Rows}}
+<tr>{{range .}}{{if .Link}}<td><a href="{{.Link}}">{{.Value}}</a></td>{{else if .Num}}<td class="num">{{.Value}}</td>{{else}}<td>{{.Value}}</td>{{end}}{{end}}</tr>
+{{end}}
+</table>
+{{end}}`
+
+const unmatchedTemplate = `{{define "title"}}Unmatched cards of {{.ID}}{{end}}
+{{define "content"}}
+{{if not .Rows}}<p>No unmatched cards.</p>{{else}}
+<p>Buylist entries that no price source knows, the translation tables may need fixing.</p>
+<table>
+<tr><th>Buylist Name</th><th>Buylist Set</th><th>CS Name</th><th>CS Set</th></tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}
+</table>
+{{end}}
+{{end}}`
+
+const historyTemplate = `{{define "title"}}Card history{{end}}
+{{define "content"}}
+<form method="get">
+Name <input name="name" value="{{.Name}}">
+Set <input name="set" value="{{.Set}}">
+<button>Search</button>
+</form>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Name}}{{if not .Records}}<p>No stored prices.</p>{{else}}
+<table>
+<tr><th>Time</th><th>Name</th><th>Set</th><th>Foil</th><th>Condition</th><th>Source</th><th>Price</th><th>Buylist Price</th></tr>
+{{range .Records}}
+<tr>
+<td>{{.Time.Local.Format "2006-01-02 15:04"}}</td>
+<td>{{.Card.Name}}</td>
+<td>{{.Card.Set}}</td>
+<td>{{if .Card.Foil}}X{{end}}</td>
+<td>{{.Card.Condition}}</td>
+<td>{{.Source}}</td>
+<td class="num">{{.Price}}</td>
+<td class="num">{{.BuylistPrice}}</td>
+</tr>
+{{end}}
+</table>
+{{end}}{{end}}
+{{end}}`
+
+var uiTemplates = map[string]*template.Template{
+	"runs":      parsePage(runsTemplate),
+	"run":       parsePage(runTemplate),
+	"unmatched": parsePage(unmatchedTemplate),
+	"history":   parsePage(historyTemplate),
+}
+
+func parsePage(page string) *template.Template {
+	return template.Must(template.Must(template.New("layout").Parse(layoutTemplate)).Parse(page))
+}
+
+func renderPage(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := uiTemplates[name].Execute(w, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// A value parsed as a number for sorting, prices and spreads included
+func sortValue(s string) (float64, bool) {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	return value, err == nil
+}
+
+type uiColumn struct {
+	Name  string
+	Link  string
+	Arrow string
+}
+
+type uiCell struct {
+	Value string
+	Link  string
+	Num   bool
+}
+
+// GET / lists the runs
+func (srv *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	renderPage(w, "runs", map[string]interface{}{
+		"Runs": srv.listRuns(),
+	})
+}
+
+// GET /runs/<id> shows the opportunities of a run, filtered by name, set,
+// finish and minimum spread, and sorted by any column; /runs/<id>/unmatched
+// the entries no source knew
+func (srv *server) handleRunPage(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/runs/"), "/")
+	run, found := srv.run(parts[0])
+	if !found || run.Status != runDone || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 2 {
+		if parts[1] != "unmatched" {
+			http.NotFound(w, r)
+			return
+		}
+		srv.unmatchedPage(w, run)
+		return
+	}
+
+	records, err := readCSVFile(srv.resultsPath(run.ID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var header []string
+	var rows []map[string]string
+	if len(records) > 0 {
+		header, records = records[0], records[1:]
+	}
+	for _, record := range records {
+		row := map[string]string{}
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	q := r.URL.Query()
+	name := q.Get("name")
+	set := q.Get("set")
+	foil := q.Get("foil") != ""
+	minSpread, hasSpread := sortValue(q.Get("spread"))
+	sortBy := q.Get("sort")
+	desc := q.Get("desc") != ""
+
+	var filtered []map[string]string
+	for _, row := range rows {
+		if name != "" && !strings.Contains(foldName(row["Name"]), foldName(name)) {
+			continue
+		}
+		if set != "" && !strings.Contains(foldSet(row["Set"]), foldSet(set)) {
+			continue
+		}
+		if foil && row["Foil"] == "" {
+			continue
+		}
+		if hasSpread {
+			spread, ok := sortValue(row["Spread"])
+			if !ok || spread < minSpread {
+				continue
+			}
+		}
+		filtered = append(filtered, row)
+	}
+
+	if sortBy != "" {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			a, b := filtered[i][sortBy], filtered[j][sortBy]
+			if desc {
+				a, b = b, a
+			}
+			x, okA := sortValue(a)
+			y, okB := sortValue(b)
+			if okA && okB {
+				return x < y
+			}
+			return a < b
+		})
+	}
+
+	// the columns of the output, but the URL one that links the name
+	var columns []uiColumn
+	for _, column := range header {
+		if column == "URL" {
+			continue
+		}
+		link := url.Values{}
+		for key, values := range q {
+			link[key] = values
+		}
+		link.Set("sort", column)
+		link.Del("desc")
+		arrow := ""
+		if column == sortBy {
+			if desc {
+				arrow = " ▼"
+			} else {
+				link.Set("desc", "1")
+				arrow = " ▲"
+			}
+		}
+		columns = append(columns, uiColumn{column, "?" + link.Encode(), arrow})
+	}
+	var table [][]uiCell
+	for _, row := range filtered {
+		var cells []uiCell
+		for _, column := range header {
+			if column == "URL" {
+				continue
+			}
+			cell := uiCell{Value: row[column]}
+			if column == "Name" {
+				cell.Link = row["URL"]
+			}
+			_, cell.Num = sortValue(row[column])
+			cells = append(cells, cell)
+		}
+		table = append(table, cells)
+	}
+
+	renderPage(w, "run", map[string]interface{}{
+		"ID":      run.ID,
+		"Name":    name,
+		"Set":     set,
+		"Foil":    foil,
+		"Spread":  q.Get("spread"),
+		"Sort":    sortBy,
+		"Desc":    desc,
+		"Columns": columns,
+		"Rows":    table,
+	})
+}
+
+// All the records of a csv file, the header included; a missing file is
+// just empty
+func readCSVFile(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+func (srv *server) unmatchedPage(w http.ResponseWriter, run serverRun) {
+	records, err := readCSVFile(srv.unmatchedPath(run.ID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(records) > 0 {
+		records = records[1:]
+	}
+	renderPage(w, "unmatched", map[string]interface{}{
+		"ID":   run.ID,
+		"Rows": records,
+	})
+}
+
+// GET /history?name=<CS name>[&set=<CS set>] shows the stored prices of
+// a card
+func (srv *server) handleHistoryPage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	data := map[string]interface{}{
+		"Name": q.Get("name"),
+		"Set":  q.Get("set"),
+	}
+	if q.Get("name") != "" {
+		records, err := cardHistory(Config.HistoryFile, q.Get("name"), q.Get("set"))
+		if err != nil && !os.IsNotExist(err) {
+			data["Error"] = err.Error()
+		}
+		data["Records"] = records
+	}
+	renderPage(w, "history", data)
+}